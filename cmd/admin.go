@@ -0,0 +1,193 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Admin API, for inspecting & controlling a running mockery
+// ----------------------------------------------------------------------------
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// All admin routes are under this prefix, which no real API should be using
+const adminPrefix = "/__mockery"
+
+// An operation being served, as listed by the admin API
+type adminRoute struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`
+	OperationID string `json:"operationId,omitempty"`
+	Summary     string `json:"summary,omitempty"`
+	API         string `json:"api"`
+	Stateful    bool   `json:"stateful"`
+	Proxied     bool   `json:"proxied"`
+}
+
+// A spec being served, with the document as it was loaded, refs resolved
+type adminSpec struct {
+	File     string `json:"file"`
+	Title    string `json:"title"`
+	Version  string `json:"version"`
+	BasePath string `json:"basePath"`
+	Document any    `json:"document"`
+}
+
+// Build the admin router, the APIs are fetched on each request as they can be reloaded
+func newAdminRouter(apis func() []*mockAPI) chi.Router {
+	router := chi.NewRouter()
+	router.Use(checkAdminKey)
+
+	router.Get("/health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ok"})
+	})
+
+	// Ready once there are APIs to serve
+	router.Get("/ready", func(w http.ResponseWriter, r *http.Request) {
+		if len(apis()) == 0 {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]any{"status": "not ready", "apis": 0})
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]any{"status": "ready", "apis": len(apis())})
+	})
+
+	router.Get("/routes", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, listRoutes(apis()))
+	})
+
+	router.Get("/specs", func(w http.ResponseWriter, r *http.Request) {
+		specs := []adminSpec{}
+
+		for _, api := range apis() {
+			// The file may have changed since it was loaded, if so the internal model is shown
+			var doc any = api.spec
+			if resolved, err := resolveSpec(api.file); err == nil {
+				doc = resolved
+			} else {
+				logger.Warn("Unable to load spec for admin API", slog.Any("file", api.file), slog.Any("error", err))
+			}
+
+			specs = append(specs, adminSpec{api.file, api.title(), api.version(), api.basePath + "/", doc})
+		}
+
+		writeJSON(w, http.StatusOK, specs)
+	})
+
+	router.Get("/config", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, config.public())
+	})
+
+	router.Route("/stubs", stubRoutes)
+	router.Route("/requests", journalRoutes)
+
+	// Clear any state, stubs, the journal & the counts used to rotate examples, and load
+	// the recordings again, so tests can start from a known point
+	router.Post("/reset", func(w http.ResponseWriter, r *http.Request) {
+		logger.Info("Resetting state")
+		store.reset()
+		stubs.clear("")
+		journal.clear()
+		counters.reset()
+
+		if err := recordings.reset(); err != nil {
+			writeProblem(w, r, http.StatusInternalServerError, "Unable to load recordings: "+err.Error(), nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return router
+}
+
+// Every operation in every API, in the order they are added to the router
+func listRoutes(apis []*mockAPI) []adminRoute {
+	routes := []adminRoute{}
+
+	for _, api := range apis {
+		for _, path := range sortedKeys(api.spec.Paths) {
+			if !strings.HasPrefix(path, "/") {
+				continue
+			}
+
+			ops := api.spec.Paths[path].operations()
+			stateful := config.stateful && findResource(api.spec.Paths, path) != nil
+
+			for _, method := range httpMethods {
+				op, defined := ops[method]
+				if !defined {
+					continue
+				}
+
+				proxied := upstream != nil && !isMocked(op)
+				routes = append(routes, adminRoute{method, api.basePath + path, op.OperationID, op.Summary, api.title(),
+					stateful, proxied})
+			}
+		}
+	}
+
+	return routes
+}
+
+// The admin API has its own key, so it's not affected by the API key
+func checkAdminKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.adminKey != "" && r.Header.Get("x-admin-key") != config.adminKey {
+			logger.Error("Not authorised, missing or invalid admin key")
+			w.WriteHeader(401)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, val any) {
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(val)
+}
+
+// Config as shown by the admin API, keys are hidden
+func (c *Config) public() map[string]any {
+	hide := func(key string) string {
+		if key == "" {
+			return ""
+		}
+
+		return "********"
+	}
+
+	return map[string]any{
+		"specFiles":      c.specFiles,
+		"port":           c.port,
+		"adminPort":      c.adminPort,
+		"logLevel":       c.logLevel.String(),
+		"apiKey":         hide(c.apiKey),
+		"adminKey":       hide(c.adminKey),
+		"certPath":       c.certPath,
+		"maxDepth":       c.maxDepth,
+		"fake":           c.fake,
+		"seed":           c.seed,
+		"seedPath":       c.seedPath,
+		"examples":       c.examples,
+		"validate":       c.validate,
+		"checkResponses": c.checkResponses,
+		"watch":          c.watch,
+		"stateful":       c.stateful,
+		"storeFile":      c.storeFile,
+		"fixtures":       c.fixtures,
+		"journalSize":    c.journalSize,
+		"proxyTarget":    c.proxyTarget,
+		"record":         c.record,
+		"playback":       c.playback,
+		"mockTags":       c.mockTags,
+		"mockOps":        c.mockOps,
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAdminAPI(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"spec.yaml": `
+swagger: "2.0"
+info:
+  title: Admin
+  version: 1.0.0
+basePath: /api
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      summary: List pets
+      responses:
+        "200":
+          description: OK
+    post:
+      responses:
+        "201":
+          description: Created
+  /pets/{petId}:
+    get:
+      responses:
+        "200":
+          description: OK
+`,
+	})
+
+	apis, err := loadAPIs([]string{filepath.Join(dir, "spec.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.apiKey = "secret"
+	config.stateful = true
+	store = newResourceStore(memoryBackend{})
+
+	defer func() {
+		config.apiKey = ""
+		config.adminKey = ""
+		config.stateful = false
+		store = newResourceStore(memoryBackend{})
+	}()
+
+	router, err := newRouter(apis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(`{"name":"Rex"}`))
+		for name, val := range headers {
+			req.Header.Set(name, val)
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("health", func(t *testing.T) {
+		if rec := send(http.MethodGet, "/__mockery/health", nil); rec.Code != http.StatusOK {
+			t.Errorf("expected admin API without the API key, got: %d", rec.Code)
+		}
+
+		if rec := send(http.MethodGet, "/__mockery/ready", nil); !strings.Contains(rec.Body.String(), `"apis":1`) {
+			t.Errorf("expected ready with 1 API, got: %s", rec.Body.String())
+		}
+	})
+
+	t.Run("routes", func(t *testing.T) {
+		var routes []adminRoute
+		if err := json.Unmarshal(send(http.MethodGet, "/__mockery/routes", nil).Body.Bytes(), &routes); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := adminRoute{http.MethodGet, "/api/pets", "listPets", "List pets", "Admin", true, false}
+		if len(routes) != 3 || routes[0] != expected {
+			t.Errorf("expected 3 routes starting with %v, got: %v", expected, routes)
+		}
+	})
+
+	t.Run("config", func(t *testing.T) {
+		body := send(http.MethodGet, "/__mockery/config", nil).Body.String()
+		if strings.Contains(body, "secret") || !strings.Contains(body, `"apiKey":"********"`) {
+			t.Errorf("expected API key to be hidden, got: %s", body)
+		}
+	})
+
+	t.Run("specs", func(t *testing.T) {
+		var specs []adminSpec
+		if err := json.Unmarshal(send(http.MethodGet, "/__mockery/specs", nil).Body.Bytes(), &specs); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(specs) != 1 || specs[0].BasePath != "/api/" || specs[0].Document.(map[string]any)["swagger"] != "2.0" {
+			t.Errorf("expected the loaded spec, got: %v", specs)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		apiKey := map[string]string{"x-api-key": "secret"}
+		send(http.MethodPost, "/api/pets", apiKey)
+
+		if rec := send(http.MethodGet, "/api/pets/1", apiKey); rec.Code != http.StatusOK {
+			t.Fatalf("expected created pet, got: %d", rec.Code)
+		}
+
+		if rec := send(http.MethodPost, "/__mockery/reset", nil); rec.Code != http.StatusNoContent {
+			t.Errorf("expected 204 from reset, got: %d", rec.Code)
+		}
+
+		if rec := send(http.MethodGet, "/api/pets/1", apiKey); rec.Code != http.StatusNotFound {
+			t.Errorf("expected pet to be gone after reset, got: %d", rec.Code)
+		}
+	})
+
+	t.Run("admin_key", func(t *testing.T) {
+		config.adminKey = "admin"
+
+		if rec := send(http.MethodGet, "/__mockery/health", nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected 401 without admin key, got: %d", rec.Code)
+		}
+
+		rec := send(http.MethodGet, "/__mockery/health", map[string]string{"x-admin-key": "admin"})
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected 200 with admin key, got: %d", rec.Code)
+		}
+	})
+}
+
+func TestReset(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"spec.yaml": `
+openapi: 3.0.0
+info:
+  title: Reset
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              examples:
+                a:
+                  value: first
+                b:
+                  value: second
+  /owners:
+    get:
+      operationId: listOwners
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              example: from spec
+`,
+	})
+
+	apis, err := loadAPIs([]string{filepath.Join(dir, "spec.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recordDir := t.TempDir()
+	config.examples = strategyRoundRobin
+	config.playback = recordDir
+
+	defer func() {
+		config.examples = strategyFirst
+		config.playback = ""
+		counters.reset()
+		recordings = &recordingStore{byName: map[string][]recording{}}
+	}()
+
+	if err := setupProxy(); err != nil {
+		t.Fatal(err)
+	}
+
+	router, err := newRouter(apis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, target string) string {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+
+		return strings.TrimSpace(rec.Body.String())
+	}
+
+	// Three requests, so the next would be the second example without a reset
+	first, second, third := send(http.MethodGet, "/pets"), send(http.MethodGet, "/pets"), send(http.MethodGet, "/pets")
+	if first != `"first"` || second != `"second"` || third != `"first"` {
+		t.Fatalf("expected examples in turn, got: %s %s %s", first, second, third)
+	}
+
+	if body := send(http.MethodGet, "/owners"); body != `"from spec"` {
+		t.Fatalf("expected response from the spec without a recording, got: %s", body)
+	}
+
+	// A recording added to the directory is only picked up after a reset
+	recording := `[{"request": {"method": "GET", "path": "/owners"}, "response": {"status": 200, "body": "recorded"}}]`
+	if err := os.WriteFile(filepath.Join(recordDir, "listOwners.json"), []byte(recording), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	send(http.MethodPost, "/__mockery/reset")
+
+	if body := send(http.MethodGet, "/pets"); body != `"first"` {
+		t.Errorf("expected the first example again after reset, got: %s", body)
+	}
+
+	if body := send(http.MethodGet, "/owners"); body != "recorded" {
+		t.Errorf("expected recordings to be loaded again after reset, got: %s", body)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Loading one or more specs & mounting them on the router
+// ----------------------------------------------------------------------------
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/go-chi/cors"
+)
+
+// A spec mounted on the router, one instance of mockery can serve several
+type mockAPI struct {
+	file string
+	spec OpenAPIv2
+
+	// Where the paths of the spec are mounted, from the base path or a prefix, never ends in a slash
+	basePath string
+}
+
+// A route to be added to the router, and the API & path in the spec it came from
+type mockRoute struct {
+	api    *mockAPI
+	method string
+	path   string
+	op     Operation
+}
+
+// Flag which can be repeated, each value is added to the list
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(val string) error {
+	*l = append(*l, val)
+	return nil
+}
+
+// Matches path parameters, so routes that only differ by parameter name are seen as the same
+var pathParamRegex = regexp.MustCompile(`{[^}]*}`)
+
+// Load all the specs, each value is a file, directory or glob with an optional =/prefix on the end
+func loadAPIs(values []string) ([]*mockAPI, error) {
+	apis := []*mockAPI{}
+
+	for _, value := range values {
+		files, prefix, err := expandSpecFiles(value)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			logger.Info("Will try to load spec document: " + file)
+
+			spec, err := ParseSpec(file)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+
+			apis = append(apis, &mockAPI{file: file, spec: spec, basePath: mountPath(spec.BasePath, prefix)})
+		}
+	}
+
+	return apis, nil
+}
+
+// Expand a value into the spec files it names & the prefix to mount them under
+// Directories & globs only include files which look like specs, so files that
+// are only used by a $ref can sit alongside them
+func expandSpecFiles(value string) ([]string, string, error) {
+	pattern, prefix := value, ""
+	if i := strings.LastIndex(value, "="); i >= 0 && strings.HasPrefix(value[i+1:], "/") {
+		pattern, prefix = value[:i], value[i+1:]
+	}
+
+	var candidates []string
+
+	if strings.ContainsAny(pattern, "*?[") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid spec file pattern %s: %w", pattern, err)
+		}
+
+		candidates = matches
+	} else {
+		info, err := os.Stat(pattern)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if !info.IsDir() {
+			return []string{pattern}, prefix, nil
+		}
+
+		entries, err := os.ReadDir(pattern)
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.IsDir() && (isYAMLFile(name) || strings.HasSuffix(name, ".json")) {
+				candidates = append(candidates, filepath.Join(pattern, name))
+			}
+		}
+	}
+
+	files := []string{}
+
+	for _, file := range candidates {
+		if isSpecDocument(file) {
+			files = append(files, file)
+		} else {
+			logger.Debug("Skipping file which is not a spec", slog.Any("file", file))
+		}
+	}
+
+	if len(files) == 0 {
+		return nil, "", fmt.Errorf("no spec files found in %s", pattern)
+	}
+
+	return files, prefix, nil
+}
+
+// Files which can't be decoded are counted as specs, so the error is reported when parsed
+func isSpecDocument(filePath string) bool {
+	var doc map[string]any
+	if err := loadSpecFile(filePath, &doc); err != nil {
+		return true
+	}
+
+	_, isV2 := doc["swagger"]
+	_, isV3 := doc["openapi"]
+
+	return isV2 || isV3
+}
+
+// Work out where to mount a spec, a prefix takes priority over the base path
+func mountPath(basePath, prefix string) string {
+	if prefix != "" {
+		basePath = prefix
+	}
+
+	// If base path doesn't start with a slash it's malformed
+	if basePath == "" || basePath[:1] != "/" {
+		logger.Warn("Base path maybe invalid or empty", slog.Any("basePath", basePath))
+		basePath = "/"
+	}
+
+	return strings.TrimSuffix(basePath, "/")
+}
+
+func (api *mockAPI) title() string {
+	if api.spec.Info.Title != "" {
+		return api.spec.Info.Title
+	}
+
+	return "Untitled API"
+}
+
+func (api *mockAPI) version() string {
+	if api.spec.Info.Version != "" {
+		return api.spec.Info.Version
+	}
+
+	return "0.0.0"
+}
+
+// Build the router serving all the APIs, an error is returned if two APIs have the same route
+func newRouter(apis []*mockAPI) (*chi.Mux, error) {
+	// Gather the routes of every API first, so clashes can be found before adding any
+	routes := map[string]map[string]mockRoute{}
+	patterns := map[string]string{}
+	conflicts := []error{}
+
+	for _, api := range apis {
+		for _, path := range sortedKeys(api.spec.Paths) {
+			if path[:1] != "/" {
+				continue
+			}
+
+			fullPath := api.basePath + path
+			key := pathParamRegex.ReplaceAllString(fullPath, "{}")
+
+			if _, exists := patterns[key]; !exists {
+				patterns[key] = fullPath
+				routes[key] = map[string]mockRoute{}
+			}
+
+			ops := api.spec.Paths[path].operations()
+
+			for _, method := range httpMethods {
+				op, defined := ops[method]
+				if !defined {
+					continue
+				}
+
+				if existing, taken := routes[key][method]; taken {
+					conflicts = append(conflicts, fmt.Errorf("route %s %s is in both %s and %s",
+						method, fullPath, existing.api.file, api.file))
+
+					continue
+				}
+
+				routes[key][method] = mockRoute{api, method, path, op}
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, errors.Join(conflicts...)
+	}
+
+	// The main router used by the server for all requests
+	router := chi.NewRouter()
+
+	// Ignore *all* CORS, this is a mock server after all
+	cors := cors.AllowAll()
+	router.Use(cors.Handler)
+
+	// Add server headers, naming the API when there's only one
+	serverName := "Mockery"
+	if len(apis) == 1 {
+		serverName = fmt.Sprintf("Mockery: %s v%s", apis[0].spec.Info.Title, apis[0].spec.Info.Version)
+	}
+
+	router.Use(middleware.SetHeader("Server", serverName))
+
+	// Every request is recorded, including those answered by stubs
+	router.Use(recordRequests)
+
+	// Stubs added with the admin API take priority over everything in the specs
+	router.Use(serveStubs)
+
+	// Custom not found handler
+	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		// When proxying, paths not in any spec may still be in the upstream
+		if upstream != nil {
+			proxyRequest(w, r, "")
+			return
+		}
+
+		logger.Error("Not found", slog.Any("path", r.URL.Path))
+		w.WriteHeader(404)
+	})
+
+	// Admin API, unless it's on its own port
+	if config.adminPort == 0 {
+		router.Mount(adminPrefix, newAdminRouter(func() []*mockAPI { return apis }))
+	}
+
+	// Lists the APIs being served, a spec can replace this with its own root path
+	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		for _, api := range apis {
+			line := "Mockery - " + api.title() + " v" + api.version()
+			if len(apis) > 1 {
+				line += " at " + api.basePath + "/"
+			}
+
+			_, _ = w.Write([]byte(line + "\n"))
+		}
+	})
+
+	// The API key is only checked for routes from the specs
+	specRouter := router.With(checkAPIKey)
+
+	for _, key := range sortedKeys(patterns) {
+		fullPath := patterns[key]
+		ops := map[string]Operation{}
+
+		for _, method := range httpMethods {
+			route, defined := routes[key][method]
+			if !defined {
+				continue
+			}
+
+			ops[method] = route.op
+
+			logger.Info(methodIcons[method]+" Adding "+method+" route", slog.Any("path", fullPath))
+			specRouter.Method(method, fullPath, createResponseHandler(route))
+		}
+
+		// HEAD is implied by GET when not in the spec, the body is dropped by net/http
+		if get, hasGet := routes[key][http.MethodGet]; hasGet && !hasMethod(ops, http.MethodHead) {
+			logger.Debug("   Adding implicit HEAD route", slog.Any("path", fullPath))
+			specRouter.Head(fullPath, createResponseHandler(get))
+		}
+
+		// Likewise OPTIONS, which just lists the allowed methods
+		if !hasMethod(ops, http.MethodOptions) {
+			logger.Debug("   Adding implicit OPTIONS route", slog.Any("path", fullPath))
+			specRouter.Options(fullPath, createOptionsHandler(allowedMethods(ops)))
+		}
+	}
+
+	return router, nil
+}
+
+// Check for x-api-key header if auth is enabled
+func checkAPIKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.apiKey == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Header.Get("x-api-key") == "" {
+			logger.Error("Not authorised, missing API key")
+			w.WriteHeader(401)
+			return
+		}
+
+		if r.Header.Get("x-api-key") != config.apiKey {
+			logger.Error("Invalid API key")
+			w.WriteHeader(401)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func hasMethod(ops map[string]Operation, method string) bool {
+	_, defined := ops[method]
+	return defined
+}
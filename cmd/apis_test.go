@@ -0,0 +1,129 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultipleAPIs(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"users.yaml": `
+swagger: "2.0"
+info:
+  title: Users
+  version: 1.0.0
+basePath: /users
+paths:
+  /{id}:
+    get:
+      responses:
+        "200":
+          description: OK
+          examples:
+            application/json: { "name": "Alice" }
+`,
+		"orders.yaml": `
+openapi: "3.0.3"
+info:
+  title: Orders
+  version: 2.0.0
+servers:
+  - url: http://localhost/orders
+paths:
+  /{orderId}:
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: "./models.yaml#/Order"
+`,
+		"models.yaml": `
+Order:
+  type: object
+  properties:
+    total:
+      type: number
+      example: 9.99
+`,
+	})
+
+	get := func(router http.Handler, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+		return rec
+	}
+
+	t.Run("directory", func(t *testing.T) {
+		apis, err := loadAPIs([]string{dir})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(apis) != 2 {
+			t.Fatalf("expected 2 APIs with models.yaml skipped, got: %d", len(apis))
+		}
+
+		router, err := newRouter(apis)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rec := get(router, "/users/1"); !strings.Contains(rec.Body.String(), "Alice") {
+			t.Errorf("expected user from users spec, got: %d %s", rec.Code, rec.Body.String())
+		}
+
+		if rec := get(router, "/orders/1"); !strings.Contains(rec.Body.String(), "9.99") {
+			t.Errorf("expected order from orders spec, got: %d %s", rec.Code, rec.Body.String())
+		}
+
+		info := get(router, "/").Body.String()
+		if !strings.Contains(info, "Orders v2.0.0 at /orders/") || !strings.Contains(info, "Users v1.0.0 at /users/") {
+			t.Errorf("expected info route to list both APIs, got: %s", info)
+		}
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		apis, err := loadAPIs([]string{filepath.Join(dir, "users.yaml") + "=/v1/people", filepath.Join(dir, "o*.yaml")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		router, err := newRouter(apis)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rec := get(router, "/v1/people/1"); rec.Code != http.StatusOK {
+			t.Errorf("expected users mounted under prefix, got: %d", rec.Code)
+		}
+
+		if rec := get(router, "/users/1"); rec.Code != http.StatusNotFound {
+			t.Errorf("expected base path to be replaced by prefix, got: %d", rec.Code)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		apis, err := loadAPIs([]string{filepath.Join(dir, "users.yaml"), filepath.Join(dir, "orders.yaml") + "=/users"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = newRouter(apis)
+		if err == nil || !strings.Contains(err.Error(), "route GET /users/{orderId} is in both") {
+			t.Errorf("expected conflict error, got: %v", err)
+		}
+	})
+
+	t.Run("no_specs", func(t *testing.T) {
+		if _, err := loadAPIs([]string{filepath.Join(dir, "*.txt")}); err == nil {
+			t.Error("expected error when glob matches no specs")
+		}
+	})
+}
@@ -0,0 +1,383 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Content negotiation & serialising payloads to media types
+// ----------------------------------------------------------------------------
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Characters which can't be in an XML name, keys of a map can be anything
+var xmlUnsafeRegex = regexp.MustCompile(`[^\p{L}\p{N}_.-]+`)
+
+// One entry of an Accept header, e.g. `text/html;q=0.8`
+type acceptRange struct {
+	mediaType string
+	quality   float64
+}
+
+// Pick the media type to respond with, from the Accept header & the media types the
+// operation produces, which should be in order of preference. If nothing matches
+// the first media type is returned along with false
+func negotiate(accept string, produces []string) (string, bool) {
+	if len(produces) == 0 {
+		produces = []string{contentType}
+	}
+
+	if strings.TrimSpace(accept) == "" {
+		return produces[0], true
+	}
+
+	for _, ar := range parseAccept(accept) {
+		for _, mediaType := range produces {
+			if mediaTypeMatches(ar.mediaType, mediaType) {
+				return mediaType, true
+			}
+		}
+	}
+
+	return produces[0], false
+}
+
+// Parse an Accept header into ranges, sorted by quality and then most specific first
+func parseAccept(accept string) []acceptRange {
+	ranges := []acceptRange{}
+
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		ar := acceptRange{
+			mediaType: strings.ToLower(strings.TrimSpace(params[0])),
+			quality:   1.0,
+		}
+
+		for _, param := range params[1:] {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "q" {
+				if q, err := strconv.ParseFloat(val, 64); err == nil {
+					ar.quality = q
+				}
+			}
+		}
+
+		if ar.mediaType != "" && ar.quality > 0 {
+			ranges = append(ranges, ar)
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].quality != ranges[j].quality {
+			return ranges[i].quality > ranges[j].quality
+		}
+
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+
+	return ranges
+}
+
+// Check if a media type satisfies a media range, which can have wildcards
+func mediaTypeMatches(mediaRange, mediaType string) bool {
+	mediaType, _, _ = strings.Cut(strings.ToLower(mediaType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+
+	if mediaRange == "*/*" || mediaRange == mediaType {
+		return true
+	}
+
+	rangeType, rangeSub, _ := strings.Cut(mediaRange, "/")
+	mainType, _, _ := strings.Cut(mediaType, "/")
+
+	return rangeSub == "*" && rangeType == mainType
+}
+
+// Media types from headers can be in any case, such as Application/JSON
+func isJSON(mediaType string) bool {
+	return strings.Contains(strings.ToLower(mediaType), "json")
+}
+
+func isXML(mediaType string) bool {
+	return strings.Contains(strings.ToLower(mediaType), "xml")
+}
+
+func isYAML(mediaType string) bool {
+	return strings.Contains(strings.ToLower(mediaType), "yaml")
+}
+
+// Serialise a payload to bytes for the given media type, the schema is used for XML
+// where it can specify element names, attributes & wrapping of arrays
+func encodePayload(mediaType string, payload any, s Schema, definitions map[string]Schema) ([]byte, error) {
+	// Strings for anything other than JSON are assumed to be already encoded, e.g.
+	// an XML example in the spec, or text/plain or text/html examples
+	if str, isString := payload.(string); isString && !isJSON(mediaType) {
+		return []byte(str), nil
+	}
+
+	mediaType, _, _ = strings.Cut(strings.ToLower(mediaType), ";")
+
+	switch {
+	case isJSON(mediaType):
+		buf := &bytes.Buffer{}
+		err := json.NewEncoder(buf).Encode(payload)
+
+		return buf.Bytes(), err
+
+	case isXML(mediaType):
+		return encodeXML(payload, s, definitions)
+
+	case isYAML(mediaType):
+		return yaml.Marshal(payload)
+
+	case mediaType == "text/csv":
+		return encodeCSV(payload)
+
+	case strings.HasPrefix(mediaType, "text/"):
+		switch payload.(type) {
+		case map[string]any, []any:
+			return json.Marshal(payload)
+		}
+
+		return []byte(fmt.Sprint(payload)), nil
+	}
+
+	// Anything else gets JSON, as that's the best we can do with a generated payload
+	return json.Marshal(payload)
+}
+
+// CSV is only really suited to arrays of flat objects, a header row is made from
+// all the keys, and any nested values are written as JSON in the cell
+func encodeCSV(payload any) ([]byte, error) {
+	var rows []any
+
+	switch p := payload.(type) {
+	case []any:
+		rows = p
+	default:
+		rows = []any{p}
+	}
+
+	columns := map[string]bool{}
+	for _, row := range rows {
+		if obj, isObj := row.(map[string]any); isObj {
+			for key := range obj {
+				columns[key] = true
+			}
+		}
+	}
+
+	header := sortedKeys(columns)
+
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+
+	if len(header) > 0 {
+		_ = writer.Write(header)
+	}
+
+	for _, row := range rows {
+		obj, isObj := row.(map[string]any)
+		if !isObj {
+			_ = writer.Write([]string{csvCell(row)})
+			continue
+		}
+
+		record := make([]string, len(header))
+		for i, key := range header {
+			record[i] = csvCell(obj[key])
+		}
+
+		_ = writer.Write(record)
+	}
+
+	writer.Flush()
+
+	return buf.Bytes(), writer.Error()
+}
+
+func csvCell(val any) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case map[string]any, []any:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+
+	return fmt.Sprint(val)
+}
+
+// Writes XML driven by the payload, using the schema to name elements & attributes
+type xmlWriter struct {
+	enc         *xml.Encoder
+	definitions map[string]Schema
+}
+
+func encodeXML(payload any, s Schema, definitions map[string]Schema) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+
+	x := xmlWriter{
+		enc:         xml.NewEncoder(buf),
+		definitions: definitions,
+	}
+	x.enc.Indent("", "  ")
+
+	s, modelName := x.resolve(s)
+
+	// Name of the root element, there's no property name so fall back to the model name
+	name := "root"
+	if modelName != "" {
+		name = modelName
+	}
+
+	// A root array needs to be wrapped to be valid XML
+	if _, isArray := payload.([]any); isArray {
+		s.XML.Wrapped = true
+	}
+
+	if err := x.element(name, payload, s); err != nil {
+		return nil, err
+	}
+
+	if err := x.enc.Flush(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Follow refs to get the real schema, also returning the model name if there was a ref
+func (x xmlWriter) resolve(s Schema) (Schema, string) {
+	modelName := ""
+
+	// Limited number of hops, in case of refs that point at each other
+	for i := 0; i < 10 && s.isRef(); i++ {
+		modelName = refName(s.Ref)
+		s = x.definitions[modelName]
+	}
+
+	return s, modelName
+}
+
+func (x xmlWriter) element(name string, value any, s Schema) error {
+	s, _ = x.resolve(s)
+	if s.XML.Name != "" {
+		name = s.XML.Name
+	} else {
+		name = xmlName(name)
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: s.XML.qualified(name)}}
+	if s.XML.Namespace != "" {
+		nsAttr := "xmlns"
+		if s.XML.Prefix != "" {
+			nsAttr += ":" + s.XML.Prefix
+		}
+
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: nsAttr}, Value: s.XML.Namespace})
+	}
+
+	switch v := value.(type) {
+	case []any:
+		itemSchema, itemModel := Schema{}, ""
+		if s.Items != nil {
+			itemSchema, itemModel = x.resolve(*s.Items)
+		}
+
+		// Items are named after their model if they have one, otherwise the array
+		itemName := name
+		if itemModel != "" {
+			itemName = itemModel
+		}
+
+		if s.XML.Wrapped {
+			if err := x.enc.EncodeToken(start); err != nil {
+				return err
+			}
+		}
+
+		for _, item := range v {
+			if err := x.element(itemName, item, itemSchema); err != nil {
+				return err
+			}
+		}
+
+		if s.XML.Wrapped {
+			return x.enc.EncodeToken(start.End())
+		}
+
+		return nil
+
+	case map[string]any:
+		keys := sortedKeys(v)
+		children := make([]string, 0, len(keys))
+
+		// Properties marked as attributes go on the start element, the rest are children
+		for _, key := range keys {
+			propSchema, _ := x.resolve(s.Properties[key])
+			if !propSchema.XML.Attribute {
+				children = append(children, key)
+				continue
+			}
+
+			attrName := xmlName(key)
+			if propSchema.XML.Name != "" {
+				attrName = propSchema.XML.Name
+			}
+
+			start.Attr = append(start.Attr, xml.Attr{
+				Name:  xml.Name{Local: propSchema.XML.qualified(attrName)},
+				Value: fmt.Sprint(v[key]),
+			})
+		}
+
+		if err := x.enc.EncodeToken(start); err != nil {
+			return err
+		}
+
+		for _, key := range children {
+			if err := x.element(key, v[key], s.Properties[key]); err != nil {
+				return err
+			}
+		}
+
+		return x.enc.EncodeToken(start.End())
+	}
+
+	if err := x.enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	if value != nil {
+		if err := x.enc.EncodeToken(xml.CharData(fmt.Sprint(value))); err != nil {
+			return err
+		}
+	}
+
+	return x.enc.EncodeToken(start.End())
+}
+
+// Make a key into a valid XML name, e.g. `key 1` becomes `key_1` and `1st` becomes `_1st`
+func xmlName(key string) string {
+	name := xmlUnsafeRegex.ReplaceAllString(key, "_")
+
+	first, _ := utf8.DecodeRuneInString(name)
+	if name == "" || (!unicode.IsLetter(first) && first != '_') {
+		name = "_" + name
+	}
+
+	return name
+}
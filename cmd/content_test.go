@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	produces := []string{"application/json", "application/xml", "text/csv"}
+
+	tests := []struct {
+		name       string
+		accept     string
+		mediaType  string
+		acceptable bool
+	}{
+		{"no_accept", "", "application/json", true},
+		{"any", "*/*", "application/json", true},
+		{"exact", "application/xml", "application/xml", true},
+		{"wildcard_subtype", "text/*", "text/csv", true},
+		{"quality", "application/json;q=0.5, application/xml", "application/xml", true},
+		{"specific_first", "*/*;q=0.9, text/csv;q=0.9", "text/csv", true},
+		{"zero_quality", "application/xml;q=0, */*;q=0.1", "application/json", true},
+		{"not_acceptable", "image/png", "application/json", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mediaType, acceptable := negotiate(test.accept, produces)
+			if mediaType != test.mediaType || acceptable != test.acceptable {
+				t.Errorf("expected %s & %v, got: %s & %v", test.mediaType, test.acceptable, mediaType, acceptable)
+			}
+		})
+	}
+}
+
+func TestEncodePayload(t *testing.T) {
+	var petSchema Schema
+	err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"xml": { "name": "pet", "prefix": "p", "namespace": "http://example.com/pet" },
+		"properties": {
+			"id": { "type": "integer", "xml": { "attribute": true } },
+			"name": { "type": "string" },
+			"tags": {
+				"type": "array",
+				"xml": { "wrapped": true },
+				"items": { "type": "string", "xml": { "name": "tag" } }
+			}
+		}
+	}`), &petSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pet := map[string]any{"id": 1, "name": "Rex", "tags": []any{"good", "dog"}}
+
+	t.Run("xml", func(t *testing.T) {
+		body, err := encodePayload("application/xml", pet, petSchema, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, expected := range []string{
+			`<p:pet xmlns:p="http://example.com/pet" id="1">`,
+			`<name>Rex</name>`,
+			"<tags>\n    <tag>good</tag>\n    <tag>dog</tag>\n  </tags>",
+		} {
+			if !strings.Contains(string(body), expected) {
+				t.Errorf("expected XML to contain %s, got:\n%s", expected, body)
+			}
+		}
+	})
+
+	t.Run("xml_root_array", func(t *testing.T) {
+		defs := map[string]Schema{"Pet": {Type: SchemaType{"object"}}}
+		s := Schema{Type: SchemaType{"array"}, Items: &Schema{Ref: "#/definitions/Pet"}}
+
+		body, err := encodePayload("text/xml", []any{map[string]any{"name": "Rex"}}, s, defs)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(body), "<root>\n  <Pet>\n    <name>Rex</name>") {
+			t.Errorf("expected wrapped array of Pet elements, got:\n%s", body)
+		}
+	})
+
+	t.Run("mixed_case", func(t *testing.T) {
+		for mediaType, expected := range map[string]string{
+			"Application/XML":    "<name>Rex</name>",
+			"application/X-YAML": "name: Rex",
+			"Text/CSV":           "id,name,tags",
+		} {
+			body, _ := encodePayload(mediaType, pet, petSchema, nil)
+			if !strings.Contains(string(body), expected) {
+				t.Errorf("expected %s for %s, got:\n%s", expected, mediaType, body)
+			}
+		}
+	})
+
+	t.Run("xml_unsafe_keys", func(t *testing.T) {
+		payload := map[string]any{"key 1": "a", "2nd": "b", "ok-name": "c"}
+
+		body, err := encodePayload("application/xml", payload, Schema{Type: SchemaType{"object"}}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := xml.Unmarshal(body, &struct{}{}); err != nil {
+			t.Errorf("expected valid XML, got: %v\n%s", err, body)
+		}
+
+		for _, expected := range []string{"<key_1>a</key_1>", "<_2nd>b</_2nd>", "<ok-name>c</ok-name>"} {
+			if !strings.Contains(string(body), expected) {
+				t.Errorf("expected XML to contain %s, got:\n%s", expected, body)
+			}
+		}
+	})
+
+	t.Run("yaml", func(t *testing.T) {
+		body, err := encodePayload("application/yaml", pet, petSchema, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !strings.Contains(string(body), "name: Rex") {
+			t.Errorf("expected YAML, got:\n%s", body)
+		}
+	})
+
+	t.Run("csv", func(t *testing.T) {
+		rows := []any{
+			map[string]any{"id": 1, "name": "Rex"},
+			map[string]any{"id": 2, "name": "Fluffy, the cat", "tags": []any{"cat"}},
+		}
+
+		body, err := encodePayload("text/csv", rows, Schema{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := "id,name,tags\n1,Rex,\n2,\"Fluffy, the cat\",\"[\"\"cat\"\"]\"\n"
+		if string(body) != expected {
+			t.Errorf("expected CSV:\n%s\ngot:\n%s", expected, body)
+		}
+	})
+
+	t.Run("raw_string", func(t *testing.T) {
+		body, _ := encodePayload("text/html", "<h1>Hello</h1>", Schema{}, nil)
+		if string(body) != "<h1>Hello</h1>" {
+			t.Errorf("expected raw string, got: %s", body)
+		}
+	})
+
+	t.Run("json_string", func(t *testing.T) {
+		body, _ := encodePayload("application/json", "hello", Schema{}, nil)
+		if string(body) != "\"hello\"\n" {
+			t.Errorf("expected JSON string, got: %s", body)
+		}
+	})
+}
+
+func TestNotAcceptable(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"spec.yaml": `
+swagger: "2.0"
+info:
+  title: Negotiation
+  version: 1.0.0
+produces: [application/json]
+paths:
+  /pets:
+    get:
+      responses:
+        "200":
+          description: OK
+          headers:
+            x-total:
+              type: integer
+              example: 3
+          examples:
+            application/json: [{ "name": "Rex" }]
+  /ping:
+    get:
+      responses:
+        "204":
+          description: No content
+`,
+	})
+
+	apis, err := loadAPIs([]string{filepath.Join(dir, "spec.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router, err := newRouter(apis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Checked before the payload or headers, even for a response without a payload
+	for _, path := range []string{"/pets", "/ping"} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Accept", "image/png")
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusNotAcceptable || rec.Header().Get("x-total") != "" || rec.Body.Len() != 0 {
+			t.Errorf("expected 406 without headers or body from %s, got: %d %v", path, rec.Code, rec.Header())
+		}
+	}
+}
@@ -0,0 +1,547 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Test subcommand, checks a live service matches the spec
+// ----------------------------------------------------------------------------
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lmittmann/tint"
+)
+
+// The outcome of calling one operation on the target
+type contractResult struct {
+	suite       string
+	method      string
+	path        string
+	operationID string
+	status      int
+	duration    time.Duration
+	problems    []string
+	skipped     string
+}
+
+// Calls every operation of the APIs on the target, checking the responses
+type contractTester struct {
+	target  string
+	headers http.Header
+	client  *http.Client
+}
+
+// Entry point for `mockery test`, returns the exit code
+func runContractTests(args []string) int {
+	var headers listFlag
+
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	specFile := flags.String("file", "", "OpenAPI spec file in JSON or YAML format")
+	flags.StringVar(specFile, "f", "", "OpenAPI spec file in JSON or YAML format")
+	target := flags.String("target", "", "Base URL of the service to test, e.g. http://localhost:8080. REQUIRED")
+	junitFile := flags.String("junit", "", "Write a JUnit XML report to this file")
+	timeout := flags.Duration("timeout", 10*time.Second, "Timeout for each request")
+	flags.Var(&headers, "header", "Header to send with every request, e.g. 'Authorization: Bearer xyz'. Can be repeated")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: mockery test -target <url> [flags] [-f] <spec file>...")
+		flags.PrintDefaults()
+	}
+
+	_ = flags.Parse(args)
+
+	files := flags.Args()
+	if *specFile != "" {
+		files = append([]string{*specFile}, files...)
+	}
+
+	if len(files) == 0 || *target == "" {
+		flags.Usage()
+		return 2
+	}
+
+	// Info logs from loading the specs would bury the report
+	logger = slog.New(tint.NewHandler(os.Stderr, &tint.Options{Level: slog.LevelWarn}))
+
+	tester, err := newContractTester(*target, headers, *timeout)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+
+	apis, err := loadAPIs(files)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	results := []contractResult{}
+	for _, api := range apis {
+		results = append(results, tester.testAPI(api)...)
+	}
+
+	failed := printResults(results)
+
+	if *junitFile != "" {
+		if err := writeJUnit(*junitFile, results); err != nil {
+			fmt.Printf("Failed to write JUnit report: %s\n", err)
+			return 1
+		}
+	}
+
+	if failed > 0 {
+		return 1
+	}
+
+	return 0
+}
+
+func newContractTester(target string, headers []string, timeout time.Duration) (*contractTester, error) {
+	targetURL, err := url.Parse(target)
+	if err != nil || targetURL.Scheme == "" || targetURL.Host == "" {
+		return nil, fmt.Errorf("target '%s' is not a valid URL", target)
+	}
+
+	t := &contractTester{
+		target:  strings.TrimSuffix(target, "/"),
+		headers: http.Header{},
+		client: &http.Client{
+			Timeout: timeout,
+
+			// Redirects are responses like any other, so they're checked not followed
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+
+	for _, header := range headers {
+		name, val, found := strings.Cut(header, ":")
+		if !found {
+			return nil, fmt.Errorf("header '%s' must be in the form 'Name: value'", header)
+		}
+
+		t.headers.Add(strings.TrimSpace(name), strings.TrimSpace(val))
+	}
+
+	return t, nil
+}
+
+// Test every operation in the API, in the same order as the routes are listed
+func (t *contractTester) testAPI(api *mockAPI) []contractResult {
+	results := []contractResult{}
+
+	for _, path := range sortedKeys(api.spec.Paths) {
+		if !strings.HasPrefix(path, "/") {
+			continue
+		}
+
+		ops := api.spec.Paths[path].operations()
+
+		for _, method := range httpMethods {
+			op, defined := ops[method]
+			if !defined {
+				continue
+			}
+
+			result := contractResult{suite: api.title(), method: method, path: api.basePath + path, operationID: op.OperationID}
+
+			// Operations still being mocked aren't in the service yet
+			if op.Mock {
+				result.skipped = "x-mock is set"
+			} else {
+				t.testOperation(api, method, path, op, &result)
+			}
+
+			results = append(results, result)
+		}
+	}
+
+	return results
+}
+
+// Call the operation with a request made from the spec, and check the response
+func (t *contractTester) testOperation(api *mockAPI, method, path string, op Operation, result *contractResult) {
+	req, err := t.newRequest(api, method, path, op)
+	if err != nil {
+		result.problems = append(result.problems, "unable to make request: "+err.Error())
+		return
+	}
+
+	start := time.Now()
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		result.problems = append(result.problems, "request failed: "+err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	result.duration = time.Since(start)
+	result.status = resp.StatusCode
+
+	if err != nil {
+		result.problems = append(result.problems, "unable to read body: "+err.Error())
+		return
+	}
+
+	result.problems = append(result.problems, checkLiveResponse(api, method, op, resp, body)...)
+}
+
+// Build a request for an operation, required parameters & bodies are filled from
+// examples in the spec, or generated from the schema when there aren't any
+func (t *contractTester) newRequest(api *mockAPI, method, path string, op Operation) (*http.Request, error) {
+	gen := newGenerator(api.spec.Definitions)
+	query := url.Values{}
+	form := url.Values{}
+	headers := http.Header{}
+	cookies := []*http.Cookie{}
+
+	var body io.Reader
+
+	for _, param := range op.Parameters {
+		// Path parameters are always required, others only when the spec says so
+		if !param.Required && param.In != "path" && param.In != "body" {
+			continue
+		}
+
+		gen.name = param.Name
+
+		// An example of the parameter is the most likely to work, then its default
+		val := param.Example
+		if val == nil {
+			val = param.Default
+		}
+
+		if val == nil {
+			val = gen.schema(param.schema())
+		}
+
+		if val == nil {
+			continue
+		}
+
+		switch param.In {
+		case "path":
+			path = strings.ReplaceAll(path, "{"+param.Name+"}", url.PathEscape(headerValue(val)))
+		case "query":
+			query.Set(param.Name, headerValue(val))
+		case "header":
+			headers.Set(param.Name, headerValue(val))
+		case "cookie":
+			cookies = append(cookies, &http.Cookie{Name: param.Name, Value: headerValue(val)})
+		case "formData":
+			form.Set(param.Name, headerValue(val))
+		case "body":
+			data, err := json.Marshal(val)
+			if err != nil {
+				return nil, err
+			}
+
+			body = bytes.NewReader(data)
+			headers.Set("Content-Type", requestMediaType(op.Consumes, api.spec.Consumes))
+		}
+	}
+
+	if len(form) > 0 {
+		body = strings.NewReader(form.Encode())
+		headers.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	target := t.target + api.basePath + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Accept", strings.Join(op.producesFor(Response{}, api.spec.Produces), ", "))
+
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+
+	return req, nil
+}
+
+// The media type to send a body as, JSON is preferred as that's what the body is encoded as
+func requestMediaType(opConsumes, specConsumes []string) string {
+	consumes := opConsumes
+	if len(consumes) == 0 {
+		consumes = specConsumes
+	}
+
+	for _, mediaType := range consumes {
+		if isJSON(mediaType) {
+			return mediaType
+		}
+	}
+
+	return contentType
+}
+
+// Check a response from the service against the spec, returning the problems found
+func checkLiveResponse(api *mockAPI, method string, op Operation, resp *http.Response, body []byte) []string {
+	specResp, key, documented := documentedResponse(op, resp.StatusCode)
+	if !documented {
+		return []string{fmt.Sprintf("status %d is not in the spec", resp.StatusCode)}
+	}
+
+	problems := []string{}
+
+	// The request is made to succeed, so a documented error is still a failure, and the
+	// default response only counts as success when there isn't a success response
+	switch {
+	case !isSuccessKey(key) && (key != "default" || resp.StatusCode/100 != 2):
+		problems = append(problems, fmt.Sprintf("status %d is not a success response", resp.StatusCode))
+	case key == "default" && hasSuccessResponse(op):
+		problems = append(problems, fmt.Sprintf("status %d is only covered by the default response", resp.StatusCode))
+	}
+
+	for _, name := range sortedKeys(specResp.Headers) {
+		if strings.EqualFold(name, "Content-Type") {
+			continue
+		}
+
+		values := resp.Header.Values(name)
+		if len(values) == 0 {
+			problems = append(problems, fmt.Sprintf("header %s is missing", name))
+			continue
+		}
+
+		header := specResp.Headers[name]
+		param := Parameters{Name: name, In: "header", Schema: header.schema(), InlineSchema: header.InlineSchema}
+
+		for _, err := range validateParam(param, values, api.spec.Definitions) {
+			problems = append(problems, fmt.Sprintf("header %s %s", name, err.String()))
+		}
+	}
+
+	// Bodies are only checked when the spec says what they should be
+	if specResp.Schema.isEmpty() || method == http.MethodHead {
+		return problems
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return append(problems, "body is empty")
+	}
+
+	mediaType := resp.Header.Get("Content-Type")
+	produces := op.producesFor(specResp, api.spec.Produces)
+
+	if !producesMatch(produces, mediaType) {
+		return append(problems, fmt.Sprintf("content type '%s' is not one of %s", mediaType, strings.Join(produces, ", ")))
+	}
+
+	// Only JSON bodies can be checked against the schema
+	if !isJSON(mediaType) {
+		return problems
+	}
+
+	var payload any
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return append(problems, "body is not valid JSON: "+err.Error())
+	}
+
+	for _, err := range newValidator(api.spec.Definitions).validate(specResp.Schema, payload) {
+		problems = append(problems, "body "+err.String())
+	}
+
+	return problems
+}
+
+// Find the response in the spec for a status, ranges like 2XX & the default response are used if needed
+// The key of the response is returned too, so callers know how the status was matched
+func documentedResponse(op Operation, status int) (Response, string, bool) {
+	for _, key := range []string{fmt.Sprint(status), fmt.Sprintf("%dXX", status/100), fmt.Sprintf("%dxx", status/100)} {
+		if resp, exists := op.Responses[key]; exists {
+			return resp, key, true
+		}
+	}
+
+	resp, exists := op.Responses["default"]
+
+	return resp, "default", exists
+}
+
+// Responses for 1xx, 2xx & 3xx are successes, e.g. a 302 from an operation which redirects
+func isSuccessKey(key string) bool {
+	return key != "" && strings.IndexByte("123", key[0]) >= 0
+}
+
+func hasSuccessResponse(op Operation) bool {
+	for key := range op.Responses {
+		if isSuccessKey(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func producesMatch(produces []string, mediaType string) bool {
+	for _, mediaRange := range produces {
+		if mediaTypeMatches(strings.ToLower(mediaRange), mediaType) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Print a line for each operation & a summary, returning the number that failed
+func printResults(results []contractResult) int {
+	passed, failed, skipped := 0, 0, 0
+
+	for _, result := range results {
+		name := result.method + " " + result.path
+		if result.operationID != "" {
+			name += " (" + result.operationID + ")"
+		}
+
+		switch {
+		case result.skipped != "":
+			skipped++
+
+			fmt.Printf("SKIP  %s, %s\n", name, result.skipped)
+
+		case len(result.problems) > 0:
+			failed++
+
+			fmt.Printf("FAIL  %s %s\n", name, result.outcome())
+
+			for _, problem := range result.problems {
+				fmt.Printf("      - %s\n", problem)
+			}
+
+		default:
+			passed++
+
+			fmt.Printf("PASS  %s %s\n", name, result.outcome())
+		}
+	}
+
+	fmt.Printf("\n%d operation(s), %d passed, %d failed, %d skipped\n", len(results), passed, failed, skipped)
+
+	return failed
+}
+
+func (r contractResult) outcome() string {
+	if r.status == 0 {
+		return "no response"
+	}
+
+	return fmt.Sprintf("%d in %dms", r.status, r.duration.Milliseconds())
+}
+
+// JUnit XML, as understood by most CI systems
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Skipped  int          `xml:"skipped,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Skipped  int         `xml:"skipped,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *junitSkipped `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitSkipped struct {
+	Message string `xml:"message,attr"`
+}
+
+// Write the results as JUnit XML, with a suite for each API
+func writeJUnit(path string, results []contractResult) error {
+	report := junitSuites{}
+	suites := map[string]int{}
+	times := []time.Duration{}
+
+	for _, result := range results {
+		index, exists := suites[result.suite]
+		if !exists {
+			index = len(report.Suites)
+			suites[result.suite] = index
+			report.Suites = append(report.Suites, junitSuite{Name: result.suite})
+			times = append(times, 0)
+		}
+
+		suite := &report.Suites[index]
+		tc := junitCase{
+			Name:      result.method + " " + result.path,
+			ClassName: result.suite,
+			Time:      fmt.Sprintf("%.3f", result.duration.Seconds()),
+		}
+
+		if result.operationID != "" {
+			tc.Name = result.operationID + " " + tc.Name
+		}
+
+		switch {
+		case result.skipped != "":
+			tc.Skipped = &junitSkipped{result.skipped}
+			suite.Skipped++
+		case len(result.problems) > 0:
+			tc.Failure = &junitFailure{result.problems[0], strings.Join(result.problems, "\n")}
+			suite.Failures++
+		}
+
+		suite.Tests++
+		suite.Cases = append(suite.Cases, tc)
+		times[index] += result.duration
+	}
+
+	for i := range report.Suites {
+		suite := &report.Suites[i]
+		suite.Time = fmt.Sprintf("%.3f", times[i].Seconds())
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Skipped += suite.Skipped
+	}
+
+	data, err := xml.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append([]byte(xml.Header), append(data, '\n')...), 0o600)
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContractTests(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"spec.yaml": `
+swagger: "2.0"
+info:
+  title: Live
+  version: 1.0.0
+basePath: /api
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      parameters:
+        - name: limit
+          in: query
+          required: true
+          type: integer
+          default: 5
+      responses:
+        "200":
+          description: OK
+          headers:
+            x-total:
+              type: integer
+          schema:
+            type: array
+            items:
+              $ref: "#/definitions/Pet"
+    post:
+      operationId: createPet
+      parameters:
+        - name: pet
+          in: body
+          schema:
+            $ref: "#/definitions/Pet"
+      responses:
+        "201":
+          description: Created
+  /pets/{petId}:
+    get:
+      operationId: getPet
+      parameters:
+        - name: petId
+          in: path
+          required: true
+          type: string
+          enum: [rex]
+      responses:
+        "200":
+          description: OK
+          schema:
+            $ref: "#/definitions/Pet"
+        4XX:
+          description: Client error
+    delete:
+      operationId: deletePet
+      responses:
+        "204":
+          description: Deleted
+  /owners:
+    get:
+      operationId: listOwners
+      responses:
+        "200":
+          description: OK
+        default:
+          description: Error
+    post:
+      operationId: createOwner
+      responses:
+        default:
+          description: Created
+    put:
+      operationId: updateOwner
+      responses:
+        "204":
+          description: Updated
+        default:
+          description: Error
+  /vets:
+    get:
+      x-mock: true
+      responses:
+        "200":
+          description: OK
+definitions:
+  Pet:
+    type: object
+    required: [name]
+    properties:
+      name:
+        type: string
+        example: Rex
+`,
+	})
+
+	// A service which only gets some of the spec right
+	requests := map[string]*http.Request{}
+	bodies := map[string]string{}
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests[r.Method+" "+r.URL.Path] = r
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/pets":
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("x-total", "many")
+			_, _ = w.Write([]byte(`[{"name": "Rex"}, {"name": 12}]`))
+		case "POST /api/pets":
+			data := make([]byte, r.ContentLength)
+			_, _ = r.Body.Read(data)
+			bodies["createPet"] = string(data)
+
+			w.WriteHeader(http.StatusCreated)
+		case "GET /api/pets/rex":
+			w.WriteHeader(http.StatusNotFound)
+		case "POST /api/owners":
+			w.WriteHeader(http.StatusCreated)
+		case "PUT /api/owners":
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer live.Close()
+
+	apis, err := loadAPIs([]string{filepath.Join(dir, "spec.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tester, err := newContractTester(live.URL+"/", []string{"Authorization: Bearer abc"}, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	results := tester.testAPI(apis[0])
+	if len(results) != 8 {
+		t.Fatalf("expected 8 results, got: %d", len(results))
+	}
+
+	byID := map[string]contractResult{}
+	for _, result := range results {
+		byID[result.operationID] = result
+	}
+
+	t.Run("requests", func(t *testing.T) {
+		list := requests["GET /api/pets"]
+		if list == nil || list.URL.Query().Get("limit") != "5" || list.Header.Get("Authorization") != "Bearer abc" {
+			t.Errorf("expected list request with default limit & extra header, got: %v", list)
+		}
+
+		if bodies["createPet"] != `{"name":"Rex"}` {
+			t.Errorf("expected body from the schema example, got: %s", bodies["createPet"])
+		}
+
+		if requests["GET /api/pets/rex"] == nil {
+			t.Errorf("expected path parameter from the enum, got: %v", sortedKeys(requests))
+		}
+	})
+
+	t.Run("checks", func(t *testing.T) {
+		problems := strings.Join(byID["listPets"].problems, "\n")
+		if !strings.Contains(problems, "header x-total") || !strings.Contains(problems, "body /1/name") {
+			t.Errorf("expected header & body problems, got: %s", problems)
+		}
+
+		if len(byID["createPet"].problems) != 0 || len(byID["createOwner"].problems) != 0 {
+			t.Errorf("expected success statuses to pass, got: %v %v", byID["createPet"].problems, byID["createOwner"].problems)
+		}
+
+		// Documented errors, or the default response when there are success responses, are failures
+		for id, expected := range map[string]string{
+			"getPet":      "status 404 is not a success response",
+			"listOwners":  "status 500 is not a success response",
+			"updateOwner": "status 200 is only covered by the default response",
+		} {
+			if problems := byID[id].problems; len(problems) != 1 || problems[0] != expected {
+				t.Errorf("expected %s to fail with %s, got: %v", id, expected, problems)
+			}
+		}
+
+		if problems := byID["deletePet"].problems; len(problems) != 1 || problems[0] != "status 500 is not in the spec" {
+			t.Errorf("expected undocumented status to fail, got: %v", problems)
+		}
+
+		if byID[""].skipped == "" || requests["GET /api/vets"] != nil {
+			t.Errorf("expected x-mock operation to be skipped, got: %+v", byID[""])
+		}
+
+		if failed := printResults(results); failed != 5 {
+			t.Errorf("expected 5 failures, got: %d", failed)
+		}
+	})
+
+	t.Run("junit", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "report.xml")
+		if err := writeJUnit(path, results); err != nil {
+			t.Fatal(err)
+		}
+
+		data, _ := os.ReadFile(path)
+
+		report := junitSuites{}
+		if err := xml.Unmarshal(data, &report); err != nil {
+			t.Fatal(err)
+		}
+
+		if report.Tests != 8 || report.Failures != 5 || report.Skipped != 1 || len(report.Suites) != 1 {
+			t.Errorf("expected 8 tests with 5 failures & 1 skipped, got: %+v", report)
+		}
+
+		failed := false
+		for _, tc := range report.Suites[0].Cases {
+			failed = failed || (tc.Name == "deletePet DELETE /api/pets/{petId}" && tc.Failure != nil)
+		}
+
+		if !failed {
+			t.Errorf("expected deletePet to fail, got: %+v", report.Suites[0].Cases)
+		}
+	})
+
+	t.Run("bad_config", func(t *testing.T) {
+		if _, err := newContractTester("localhost", nil, time.Second); err == nil {
+			t.Errorf("expected error for target without a scheme")
+		}
+
+		if _, err := newContractTester(live.URL, []string{"no colon"}, time.Second); err == nil {
+			t.Errorf("expected error for header without a colon")
+		}
+	})
+}
+
+func TestContractParamExamples(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"spec.yaml": `
+openapi: 3.0.3
+info:
+  title: Examples
+  version: 1.0.0
+paths:
+  /pets/{petId}:
+    get:
+      parameters:
+        - name: petId
+          in: path
+          required: true
+          schema:
+            type: integer
+          example: 42
+        - name: kind
+          in: query
+          required: true
+          schema:
+            type: string
+          examples:
+            dog:
+              value: dog
+      responses:
+        "200":
+          description: OK
+`,
+		"v2.yaml": `
+swagger: "2.0"
+info:
+  title: Examples
+  version: 1.0.0
+paths:
+  /owners/{ownerId}:
+    get:
+      parameters:
+        - name: ownerId
+          in: path
+          required: true
+          type: string
+          x-example: bob
+      responses:
+        "200":
+          description: OK
+`,
+	})
+
+	var targets []string
+	live := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		targets = append(targets, r.URL.RequestURI())
+	}))
+	defer live.Close()
+
+	apis, err := loadAPIs([]string{filepath.Join(dir, "spec.yaml"), filepath.Join(dir, "v2.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tester, err := newContractTester(live.URL, nil, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, api := range apis {
+		tester.testAPI(api)
+	}
+
+	if strings.Join(targets, " ") != "/pets/42?kind=dog /owners/bob" {
+		t.Errorf("expected parameters from their examples, got: %v", targets)
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Realistic fake data, driven by property names & formats
+// ----------------------------------------------------------------------------
+
+import (
+	"encoding/base64"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	fakeFirstNames = []string{"James", "Mary", "Ahmed", "Priya", "Chen", "Sofia", "Liam", "Amara",
+		"Mateo", "Yuki", "Olivia", "Noah", "Fatima", "Lucas", "Ingrid", "Kwame"}
+	fakeLastNames = []string{"Smith", "Garcia", "Khan", "Patel", "Wang", "Rossi", "Murphy", "Okafor",
+		"Silva", "Tanaka", "Jones", "Schmidt", "Haddad", "Novak", "Larsen", "Mensah"}
+	fakeCities = []string{"London", "Paris", "Tokyo", "Nairobi", "Lima", "Toronto", "Sydney", "Mumbai",
+		"Berlin", "Seoul", "Lagos", "Madrid", "Chicago", "Oslo", "Cairo", "Auckland"}
+	fakeCountries = []string{"United Kingdom", "France", "Japan", "Kenya", "Peru", "Canada", "Australia",
+		"India", "Germany", "South Korea", "Nigeria", "Spain", "United States", "Norway", "Egypt"}
+	fakeStreets = []string{"High Street", "Station Road", "Main Street", "Church Lane", "Park Avenue",
+		"Mill Road", "Victoria Street", "Oak Drive", "Elm Close", "Bridge Street"}
+	fakeCompanies = []string{"Acme Corp", "Globex", "Initech", "Umbrella Ltd", "Stark Industries",
+		"Wayne Enterprises", "Hooli", "Vandelay Industries", "Soylent Co", "Cyberdyne Systems"}
+	fakeWords = []string{"alpha", "bravo", "cedar", "delta", "ember", "falcon", "granite", "harbour",
+		"indigo", "juniper", "kestrel", "lunar", "meadow", "nimbus", "orchid", "pebble", "quartz",
+		"river", "summit", "tundra", "velvet", "willow", "zephyr"}
+	fakeColours    = []string{"red", "green", "blue", "yellow", "purple", "orange", "black", "white"}
+	fakeCurrencies = []string{"GBP", "USD", "EUR", "JPY", "INR", "AUD", "CAD"}
+	fakeLanguages  = []string{"en", "fr", "de", "es", "ja", "hi", "pt"}
+)
+
+// Matches property names, which are lower cased with _ and - removed first
+// Short names are risky as substrings, e.g. "age" in "page" so they need an exact match
+type nameMatcher struct {
+	contains []string
+	equals   []string
+}
+
+func (m nameMatcher) matches(name string) bool {
+	for _, sub := range m.contains {
+		if strings.Contains(name, sub) {
+			return true
+		}
+	}
+
+	for _, exact := range m.equals {
+		if name == exact {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Fake string generators matched against property names, first match wins so the
+// more specific names need to come first
+var fakeStringRules = []struct {
+	match nameMatcher
+	fake  func(g *generator) string
+}{
+	{nameMatcher{contains: []string{"firstname", "givenname", "forename"}}, func(g *generator) string {
+		return g.pick(fakeFirstNames)
+	}},
+	{nameMatcher{contains: []string{"lastname", "surname", "familyname"}}, func(g *generator) string {
+		return g.pick(fakeLastNames)
+	}},
+	{nameMatcher{contains: []string{"username", "login"}, equals: []string{"handle"}}, func(g *generator) string {
+		return strings.ToLower(g.pick(fakeFirstNames)) + fmt.Sprint(g.rand.Intn(1000))
+	}},
+	{nameMatcher{contains: []string{"email"}}, func(g *generator) string {
+		return g.fakeEmail()
+	}},
+	{nameMatcher{contains: []string{"phone", "mobile"}, equals: []string{"tel"}}, func(g *generator) string {
+		return fmt.Sprintf("+44 7%03d %06d", g.rand.Intn(1000), g.rand.Intn(1000000))
+	}},
+	{nameMatcher{contains: []string{"url", "website", "homepage"}, equals: []string{"link", "href"}},
+		func(g *generator) string {
+			return "https://www." + g.pick(fakeWords) + ".com"
+		}},
+	{nameMatcher{contains: []string{"street", "address"}}, func(g *generator) string {
+		return fmt.Sprintf("%d %s", g.rand.Intn(200)+1, g.pick(fakeStreets))
+	}},
+	{nameMatcher{contains: []string{"city"}, equals: []string{"town"}}, func(g *generator) string {
+		return g.pick(fakeCities)
+	}},
+	{nameMatcher{contains: []string{"country"}}, func(g *generator) string {
+		return g.pick(fakeCountries)
+	}},
+	{nameMatcher{contains: []string{"postcode", "postalcode", "zipcode"}, equals: []string{"zip"}},
+		func(g *generator) string {
+			return fmt.Sprintf("%05d", g.rand.Intn(100000))
+		}},
+	{nameMatcher{contains: []string{"company", "organisation", "organization", "employer"}}, func(g *generator) string {
+		return g.pick(fakeCompanies)
+	}},
+	{nameMatcher{contains: []string{"colour", "color"}}, func(g *generator) string {
+		return g.pick(fakeColours)
+	}},
+	{nameMatcher{contains: []string{"currency"}}, func(g *generator) string {
+		return g.pick(fakeCurrencies)
+	}},
+	{nameMatcher{contains: []string{"language", "locale"}, equals: []string{"lang"}}, func(g *generator) string {
+		return g.pick(fakeLanguages)
+	}},
+	{nameMatcher{contains: []string{"description", "summary", "comment", "notes", "message"},
+		equals: []string{"text", "body"}}, func(g *generator) string {
+		return g.fakeSentence()
+	}},
+	{nameMatcher{contains: []string{"title", "subject", "label"}}, func(g *generator) string {
+		title := g.pick(fakeWords) + " " + g.pick(fakeWords)
+		return strings.ToUpper(title[:1]) + title[1:]
+	}},
+	{nameMatcher{contains: []string{"fullname", "name"}}, func(g *generator) string {
+		return g.pick(fakeFirstNames) + " " + g.pick(fakeLastNames)
+	}},
+	{nameMatcher{contains: []string{"date", "timestamp", "createdat", "updatedat", "deletedat"}},
+		func(g *generator) string {
+			return g.fakeTime().Format(time.RFC3339)
+		}},
+	{nameMatcher{contains: []string{"uuid", "guid"}}, func(g *generator) string {
+		return g.fakeUUID()
+	}},
+}
+
+// Ranges for fake numbers matched against property names, the schema bounds
+// are applied on top of these
+var fakeNumberRules = []struct {
+	match      nameMatcher
+	lower      float64
+	upper      float64
+	fractional bool
+}{
+	{nameMatcher{contains: []string{"price", "amount", "cost", "total", "balance", "salary"}}, 1, 500, true},
+	{nameMatcher{contains: []string{"latitude"}, equals: []string{"lat"}}, -90, 90, true},
+	{nameMatcher{contains: []string{"longitude"}, equals: []string{"lng", "lon"}}, -180, 180, true},
+	{nameMatcher{equals: []string{"age"}}, 18, 90, false},
+	{nameMatcher{contains: []string{"year"}}, 1990, 2030, false},
+	{nameMatcher{contains: []string{"rating", "score", "stars"}}, 1, 5, false},
+	{nameMatcher{contains: []string{"percent"}}, 0, 100, false},
+	{nameMatcher{contains: []string{"quantity", "count"}, equals: []string{"qty"}}, 1, 20, false},
+}
+
+// Fake version of the scalar fallback values
+func (g *generator) fakeScalar(s Schema) interface{} {
+	switch s.scalarType() {
+	case "string":
+		return g.fakeString(s)
+	case "integer":
+		return int64(g.fakeNumber(s, true))
+	case "number":
+		return g.fakeNumber(s, false)
+	case "boolean":
+		return g.rand.Intn(2) == 1
+	}
+
+	return nil
+}
+
+// Seed the generator from the request path, so the same path always gets the same data
+func (g *generator) seedFromPath(path string) {
+	hash := fnv.New64a()
+	_, _ = hash.Write([]byte(path))
+
+	g.rand.Seed(config.seed ^ int64(hash.Sum64()))
+}
+
+func (g *generator) fakeString(s Schema) string {
+	switch s.Format {
+	case "date":
+		return g.fakeTime().Format(time.DateOnly)
+	case "date-time":
+		return g.fakeTime().Format(time.RFC3339)
+	case "time":
+		return g.fakeTime().Format(time.TimeOnly)
+	case "uuid":
+		return g.fakeUUID()
+	case "email":
+		return g.fakeEmail()
+	case "uri", "url":
+		return "https://www." + g.pick(fakeWords) + ".com/" + g.pick(fakeWords)
+	case "hostname":
+		return g.pick(fakeWords) + ".example.com"
+	case "ipv4":
+		return fmt.Sprintf("%d.%d.%d.%d", g.rand.Intn(223)+1, g.rand.Intn(256), g.rand.Intn(256), g.rand.Intn(255)+1)
+	case "ipv6":
+		return fmt.Sprintf("2001:db8:%x:%x::%x", g.rand.Intn(0xffff), g.rand.Intn(0xffff), g.rand.Intn(0xffff)+1)
+	case "byte":
+		return base64.StdEncoding.EncodeToString([]byte(g.fakeSentence()))
+	}
+
+	// Formats we don't know about, and patterns are best left to the regular generator
+	if s.Format != "" || s.Pattern != "" {
+		return stringValue(s)
+	}
+
+	val := g.pick(fakeWords)
+
+	name := normalisedName(g.name)
+	for _, rule := range fakeStringRules {
+		if rule.match.matches(name) {
+			val = rule.fake(g)
+			break
+		}
+	}
+
+	if s.MinLength != nil && len(val) < *s.MinLength {
+		val += strings.Repeat("x", *s.MinLength-len(val))
+	}
+
+	if s.MaxLength != nil && len(val) > *s.MaxLength && *s.MaxLength >= 0 {
+		val = val[:*s.MaxLength]
+	}
+
+	return val
+}
+
+func (g *generator) fakeNumber(s Schema, integer bool) float64 {
+	lower, upper, fractional := 0.0, 1000.0, !integer
+
+	name := normalisedName(g.name)
+	for _, rule := range fakeNumberRules {
+		if rule.match.matches(name) {
+			lower, upper, fractional = rule.lower, rule.upper, rule.fractional && !integer
+			break
+		}
+	}
+
+	// Schema bounds win over the name based ones
+	if bound, exclusive := s.lowerBound(); bound != nil {
+		lower = *bound
+		if exclusive {
+			lower++
+		}
+		upper = math.Max(upper, lower+1000)
+	}
+
+	if bound, exclusive := s.upperBound(); bound != nil {
+		upper = *bound
+		if exclusive {
+			upper--
+		}
+	}
+
+	if upper < lower {
+		return numberValue(s, integer)
+	}
+
+	val := lower + g.rand.Float64()*(upper-lower)
+
+	switch {
+	case s.MultipleOf != nil && *s.MultipleOf > 0:
+		val = math.Floor(val / *s.MultipleOf) * *s.MultipleOf
+		if val < lower {
+			return numberValue(s, integer)
+		}
+	case fractional:
+		val = math.Round(val*100) / 100
+	default:
+		val = math.Round(val)
+	}
+
+	return val
+}
+
+func (g *generator) pick(list []string) string {
+	return list[g.rand.Intn(len(list))]
+}
+
+func (g *generator) fakeEmail() string {
+	return strings.ToLower(g.pick(fakeFirstNames)+"."+g.pick(fakeLastNames)) + "@example.com"
+}
+
+func (g *generator) fakeSentence() string {
+	words := make([]string, 0, 8)
+	for i := 0; i < 4+g.rand.Intn(5); i++ {
+		words = append(words, g.pick(fakeWords))
+	}
+
+	sentence := strings.Join(words, " ")
+
+	return strings.ToUpper(sentence[:1]) + sentence[1:] + "."
+}
+
+// Random time within a few years of 2024, fixed rather than based on now, so it's repeatable
+func (g *generator) fakeTime() time.Time {
+	base := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	return base.Add(time.Duration(g.rand.Int63n(int64(4 * 365 * 24 * time.Hour)))).Truncate(time.Second)
+}
+
+// Random v4 UUID from the seeded generator, crypto/rand would not be repeatable
+func (g *generator) fakeUUID() string {
+	b := make([]byte, 16)
+	_, _ = g.rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func normalisedName(name string) string {
+	return strings.NewReplacer("_", "", "-", "", " ", "").Replace(strings.ToLower(name))
+}
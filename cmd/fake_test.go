@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFakeData(t *testing.T) {
+	var person Schema
+	err := json.Unmarshal([]byte(`{
+		"type": "object",
+		"properties": {
+			"firstName": { "type": "string" },
+			"email": { "type": "string" },
+			"createdAt": { "type": "string", "format": "date-time" },
+			"id": { "type": "string", "format": "uuid" },
+			"age": { "type": "integer" },
+			"page": { "type": "integer", "minimum": 1, "maximum": 3 },
+			"price": { "type": "number" },
+			"status": { "type": "string", "enum": ["active", "disabled"] }
+		}
+	}`), &person)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savedSeed := config.seed
+	defer func() { config.seed = savedSeed }()
+
+	fakeGenerator := func(seed int64) *generator {
+		config.fake = true
+		config.seed = seed
+		defer func() { config.fake = false }()
+
+		return newGenerator(nil)
+	}
+
+	t.Run("deterministic", func(t *testing.T) {
+		first := fakeGenerator(42).schema(person)
+		second := fakeGenerator(42).schema(person)
+
+		if !reflect.DeepEqual(first, second) {
+			t.Errorf("expected the same payload for the same seed, got: %v and %v", first, second)
+		}
+
+		other := fakeGenerator(43).schema(person)
+		if reflect.DeepEqual(first, other) {
+			t.Error("expected a different payload for a different seed")
+		}
+	})
+
+	t.Run("seed_path", func(t *testing.T) {
+		gen1 := fakeGenerator(42)
+		gen1.seedFromPath("/pets/1")
+		gen2 := fakeGenerator(42)
+		gen2.seedFromPath("/pets/1")
+		gen3 := fakeGenerator(42)
+		gen3.seedFromPath("/pets/2")
+
+		pet1, pet1Again, pet2 := gen1.schema(person), gen2.schema(person), gen3.schema(person)
+		if !reflect.DeepEqual(pet1, pet1Again) {
+			t.Error("expected the same payload for the same path")
+		}
+
+		if reflect.DeepEqual(pet1, pet2) {
+			t.Error("expected a different payload for a different path")
+		}
+	})
+
+	t.Run("realistic", func(t *testing.T) {
+		data := fakeGenerator(42).schema(person).(map[string]any)
+
+		if !strings.HasSuffix(data["email"].(string), "@example.com") {
+			t.Errorf("expected an email address, got: %v", data["email"])
+		}
+
+		if age := data["age"].(int64); age < 18 || age > 90 {
+			t.Errorf("expected a realistic age, got: %v", age)
+		}
+
+		if page := data["page"].(int64); page < 1 || page > 3 {
+			t.Errorf("expected page within bounds, got: %v", page)
+		}
+
+		if id := data["id"].(string); len(id) != 36 || id[14] != '4' {
+			t.Errorf("expected a v4 UUID, got: %v", id)
+		}
+
+		if status := data["status"]; status != "active" && status != "disabled" {
+			t.Errorf("expected a value from the enum, got: %v", status)
+		}
+	})
+}
@@ -0,0 +1,209 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Journal of the requests received, so tests can check what was called
+// ----------------------------------------------------------------------------
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// Bodies larger than this are cut short in the journal, the request itself is not affected
+const maxJournalBody = 64 * 1024
+
+// A request as it was received, and what was sent back
+type journalEntry struct {
+	ID          int         `json:"id"`
+	Time        time.Time   `json:"time"`
+	Method      string      `json:"method"`
+	Path        string      `json:"path"`
+	Query       string      `json:"query,omitempty"`
+	OperationID string      `json:"operationId,omitempty"`
+	Stub        string      `json:"stub,omitempty"`
+	Headers     http.Header `json:"headers"`
+	Body        string      `json:"body,omitempty"`
+	Status      int         `json:"status"`
+	Duration    float64     `json:"durationMs"`
+}
+
+// Finds requests in the journal, the operation is checked as well as the request
+type journalQuery struct {
+	requestPattern
+	OperationID string `json:"operationId,omitempty"`
+}
+
+// The most recent requests, oldest first, older ones are dropped once it's full
+type requestJournal struct {
+	lock    sync.RWMutex
+	entries []*journalEntry
+	lastID  int
+}
+
+var journal = &requestJournal{}
+
+type journalKey struct{}
+
+func (j *requestJournal) add(e *journalEntry) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.lastID++
+	e.ID = j.lastID
+	j.entries = append(j.entries, e)
+
+	if len(j.entries) > config.journalSize {
+		j.entries = j.entries[len(j.entries)-config.journalSize:]
+	}
+}
+
+// Entries matching the query, or all entries when it's nil
+func (j *requestJournal) find(q *journalQuery) []*journalEntry {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+
+	found := []*journalEntry{}
+
+	for _, e := range j.entries {
+		if q == nil || q.matches(e) {
+			found = append(found, e)
+		}
+	}
+
+	return found
+}
+
+func (j *requestJournal) clear() {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	j.entries = nil
+}
+
+func (q *journalQuery) matches(e *journalEntry) bool {
+	if q.OperationID != "" && q.OperationID != e.OperationID {
+		return false
+	}
+
+	query, _ := url.ParseQuery(e.Query)
+
+	return q.requestPattern.matches(e.Method, e.Path, query, e.Headers, []byte(e.Body))
+}
+
+// The journal entry for a request, so handlers can add what they know, nil if it's not recorded
+func journalEntryFor(r *http.Request) *journalEntry {
+	e, _ := r.Context().Value(journalKey{}).(*journalEntry)
+	return e
+}
+
+// Middleware which records every request to the APIs, it's added to the journal once handled
+func recordRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if config.journalSize <= 0 || strings.HasPrefix(r.URL.Path, adminPrefix+"/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		if len(body) > maxJournalBody {
+			body = body[:maxJournalBody]
+		}
+
+		e := &journalEntry{
+			Time:    time.Now(),
+			Method:  r.Method,
+			Path:    r.URL.Path,
+			Query:   r.URL.RawQuery,
+			Headers: redactHeaders(r.Header),
+			Body:    string(body),
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), journalKey{}, e)))
+
+		e.Status = ww.Status()
+		if e.Status == 0 {
+			e.Status = http.StatusOK
+		}
+
+		e.Duration = float64(time.Since(e.Time).Microseconds()) / 1000
+		journal.add(e)
+	})
+}
+
+// Copy of the headers with any keys & credentials hidden, the same as in the config
+func redactHeaders(headers http.Header) http.Header {
+	redacted := headers.Clone()
+
+	for _, name := range []string{"Authorization", "x-api-key", "x-admin-key"} {
+		if redacted.Get(name) != "" {
+			redacted.Set(name, "********")
+		}
+	}
+
+	return redacted
+}
+
+// Admin routes for querying & clearing the journal
+func journalRoutes(router chi.Router) {
+	// All requests, or only the most recent with ?limit=
+	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		entries := journal.find(nil)
+
+		if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit >= 0 && limit < len(entries) {
+			entries = entries[len(entries)-limit:]
+		}
+
+		writeJSON(w, http.StatusOK, entries)
+	})
+
+	router.Post("/find", func(w http.ResponseWriter, r *http.Request) {
+		if q := readJournalQuery(w, r); q != nil {
+			writeJSON(w, http.StatusOK, journal.find(q))
+		}
+	})
+
+	router.Post("/count", func(w http.ResponseWriter, r *http.Request) {
+		if q := readJournalQuery(w, r); q != nil {
+			writeJSON(w, http.StatusOK, map[string]any{"count": len(journal.find(q))})
+		}
+	})
+
+	router.Delete("/", func(w http.ResponseWriter, r *http.Request) {
+		journal.clear()
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Read a query from the request body, an empty body matches everything
+// Writes a problem and returns nil if it's not valid
+func readJournalQuery(w http.ResponseWriter, r *http.Request) *journalQuery {
+	q := &journalQuery{}
+
+	if err := json.NewDecoder(r.Body).Decode(q); err != nil && !errors.Is(err, io.EOF) {
+		writeProblem(w, r, http.StatusBadRequest, "Query is not valid JSON: "+err.Error(), nil)
+		return nil
+	}
+
+	if err := q.prepare(); err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "Query is not valid: "+err.Error(), nil)
+		return nil
+	}
+
+	return q
+}
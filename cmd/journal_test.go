@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"spec.yaml": `
+swagger: "2.0"
+info:
+  title: Journal
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      operationId: listPets
+      responses:
+        "200":
+          description: OK
+    post:
+      operationId: createPet
+      responses:
+        "201":
+          description: Created
+`,
+	})
+
+	apis, err := loadAPIs([]string{filepath.Join(dir, "spec.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal = &requestJournal{}
+
+	defer func() {
+		config.journalSize = 1000
+		journal = &requestJournal{}
+		stubs = &stubRegistry{}
+	}()
+
+	router, err := newRouter(apis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("x-test", "yes")
+		req.Header.Set("Authorization", "Bearer secret")
+		req.Header.Set("x-api-key", "secret")
+		req.Header.Set("x-admin-key", "secret")
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	count := func(t *testing.T, query string) int {
+		rec := send(http.MethodPost, "/__mockery/requests/count", query)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected count, got: %d %s", rec.Code, rec.Body.String())
+		}
+
+		result := map[string]int{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &result)
+
+		return result["count"]
+	}
+
+	send(http.MethodGet, "/pets?limit=5", "")
+	send(http.MethodPost, "/pets", `{"name": "Rex", "tags": ["good"]}`)
+	send(http.MethodPost, "/pets", `{"name": "Fido"}`)
+	send(http.MethodGet, "/missing", "")
+
+	t.Run("list", func(t *testing.T) {
+		var entries []journalEntry
+		_ = json.Unmarshal(send(http.MethodGet, "/__mockery/requests", "").Body.Bytes(), &entries)
+
+		if len(entries) != 4 {
+			t.Fatalf("expected 4 requests without admin requests, got: %d", len(entries))
+		}
+
+		e := entries[1]
+		if e.Method != http.MethodPost || e.OperationID != "createPet" || e.Status != 201 ||
+			!strings.Contains(e.Body, "Rex") || e.Headers.Get("x-test") != "yes" {
+			t.Errorf("expected createPet request, got: %+v", e)
+		}
+
+		for _, name := range []string{"Authorization", "x-api-key", "x-admin-key"} {
+			if val := e.Headers.Get(name); val != "********" {
+				t.Errorf("expected %s to be hidden, got: %s", name, val)
+			}
+		}
+
+		if entries[3].Status != 404 || entries[3].OperationID != "" {
+			t.Errorf("expected not found request, got: %+v", entries[3])
+		}
+
+		_ = json.Unmarshal(send(http.MethodGet, "/__mockery/requests?limit=1", "").Body.Bytes(), &entries)
+		if len(entries) != 1 || entries[0].Path != "/missing" {
+			t.Errorf("expected most recent request, got: %+v", entries)
+		}
+	})
+
+	t.Run("count", func(t *testing.T) {
+		tests := map[string]int{
+			``:                                     4,
+			`{"operationId": "createPet"}`:         2,
+			`{"method": "GET", "path": "/pets"}`:   1,
+			`{"query": {"limit": "5"}}`:            1,
+			`{"headers": {"x-test": "yes"}}`:       4,
+			`{"bodyPaths": {"$.tags[0]": "good"}}`: 1,
+			`{"body": {"name": "Fido"}}`:           1,
+			`{"pathPattern": "^/mis"}`:             1,
+		}
+
+		for query, expected := range tests {
+			if got := count(t, query); got != expected {
+				t.Errorf("expected %d for %s, got: %d", expected, query, got)
+			}
+		}
+	})
+
+	t.Run("find", func(t *testing.T) {
+		var entries []journalEntry
+		rec := send(http.MethodPost, "/__mockery/requests/find", `{"operationId": "listPets"}`)
+		_ = json.Unmarshal(rec.Body.Bytes(), &entries)
+
+		if len(entries) != 1 || entries[0].Query != "limit=5" {
+			t.Errorf("expected listPets request, got: %+v", entries)
+		}
+
+		if rec := send(http.MethodPost, "/__mockery/requests/find", `{"pathPattern": "("}`); rec.Code != 400 {
+			t.Errorf("expected 400 for bad pattern, got: %d", rec.Code)
+		}
+	})
+
+	t.Run("stub", func(t *testing.T) {
+		send(http.MethodPost, "/__mockery/stubs", `{"request": {"path": "/stubbed"}, "response": {"status": 202}}`)
+		send(http.MethodGet, "/stubbed", "")
+
+		var entries []journalEntry
+		_ = json.Unmarshal(send(http.MethodGet, "/__mockery/requests?limit=1", "").Body.Bytes(), &entries)
+
+		if len(entries) != 1 || entries[0].Stub == "" || entries[0].Status != 202 {
+			t.Errorf("expected request answered by stub, got: %+v", entries)
+		}
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		config.journalSize = 2
+
+		for i := 0; i < 3; i++ {
+			send(http.MethodGet, "/pets", "")
+		}
+
+		if got := count(t, ""); got != 2 {
+			t.Errorf("expected journal to keep 2 requests, got: %d", got)
+		}
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		if rec := send(http.MethodDelete, "/__mockery/requests", ""); rec.Code != http.StatusNoContent {
+			t.Errorf("expected 204 from clear, got: %d", rec.Code)
+		}
+
+		if got := count(t, ""); got != 0 {
+			t.Errorf("expected empty journal, got: %d", got)
+		}
+	})
+}
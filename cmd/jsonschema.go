@@ -0,0 +1,427 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Validation of values against JSON Schema
+// ----------------------------------------------------------------------------
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A value that doesn't match a schema, the pointer is where in the value it was found
+type schemaError struct {
+	Pointer string
+	Detail  string
+}
+
+func (e schemaError) String() string {
+	if e.Pointer == "" {
+		return e.Detail
+	}
+
+	return e.Pointer + " " + e.Detail
+}
+
+// Validates decoded JSON values (or anything decoded to the same types) against a schema
+type validator struct {
+	definitions map[string]Schema
+	// Models being checked at each pointer, like the generator this stops refs looping forever
+	active map[string]bool
+}
+
+func newValidator(definitions map[string]Schema) validator {
+	return validator{definitions: definitions, active: map[string]bool{}}
+}
+
+// Validate a value against a schema, returning every error found
+func (v validator) validate(s Schema, val any) []schemaError {
+	return v.check(s, val, "")
+}
+
+func (v validator) check(s Schema, val any, pointer string) []schemaError {
+	// A model checked again for the same value, e.g. with an allOf back to itself, adds nothing new
+	if s.isRef() {
+		key := refName(s.Ref) + " " + pointer
+		if v.active[key] {
+			logger.Debug("Cycle detected, not checking model again", slog.Any("model", refName(s.Ref)))
+			return nil
+		}
+
+		v.active[key] = true
+		defer delete(v.active, key)
+	}
+
+	s = v.resolve(s)
+
+	if val == nil && s.Nullable {
+		return nil
+	}
+
+	errs := []schemaError{}
+	fail := func(format string, args ...any) {
+		errs = append(errs, schemaError{pointer, fmt.Sprintf(format, args...)})
+	}
+
+	// A value of the wrong type can't be checked any further
+	if len(s.Type) > 0 && !matchesType(s.Type, val) {
+		fail("must be of type %s, got %s", strings.Join(s.Type, " or "), typeOf(val))
+		return errs
+	}
+
+	if s.Const != nil && !equalValues(s.Const, val) {
+		fail("must be %v", s.Const)
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, val) {
+		fail("must be one of %v", s.Enum)
+	}
+
+	switch value := val.(type) {
+	case string:
+		length := utf8.RuneCountInString(value)
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("must be at least %d characters", *s.MinLength)
+		}
+
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("must be at most %d characters", *s.MaxLength)
+		}
+
+		if s.Pattern != "" {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(value) {
+				fail("must match pattern %s", s.Pattern)
+			}
+		}
+
+	case []any:
+		errs = append(errs, v.array(s, value, pointer)...)
+
+	case map[string]any:
+		errs = append(errs, v.object(s, value, pointer)...)
+	}
+
+	if num, isNum := toFloat(val); isNum {
+		for _, detail := range checkNumber(s, num) {
+			fail("%s", detail)
+		}
+	}
+
+	return append(errs, v.composition(s, val, pointer)...)
+}
+
+// Follow refs to the model in the definitions, with a limit in case they point at each other
+func (v validator) resolve(s Schema) Schema {
+	for i := 0; i < 10 && s.isRef(); i++ {
+		model, exists := v.definitions[refName(s.Ref)]
+		if !exists {
+			logger.Warn("Model not found in definitions", slog.Any("model", refName(s.Ref)))
+			return Schema{}
+		}
+
+		s = model
+	}
+
+	return s
+}
+
+func (v validator) array(s Schema, items []any, pointer string) []schemaError {
+	errs := []schemaError{}
+
+	if s.MinItems != nil && len(items) < *s.MinItems {
+		errs = append(errs, schemaError{pointer, fmt.Sprintf("must have at least %d items", *s.MinItems)})
+	}
+
+	if s.MaxItems != nil && len(items) > *s.MaxItems {
+		errs = append(errs, schemaError{pointer, fmt.Sprintf("must have at most %d items", *s.MaxItems)})
+	}
+
+	if s.UniqueItems {
+		for i := range items {
+			for j := 0; j < i; j++ {
+				if equalValues(items[i], items[j]) {
+					errs = append(errs, schemaError{pointerTo(pointer, i), fmt.Sprintf("is a duplicate of item %d", j)})
+				}
+			}
+		}
+	}
+
+	// Tuples have a schema per position, any items after that are checked against items
+	for i, item := range items {
+		switch {
+		case i < len(s.PrefixItems):
+			errs = append(errs, v.check(s.PrefixItems[i], item, pointerTo(pointer, i))...)
+		case s.Items != nil:
+			errs = append(errs, v.check(*s.Items, item, pointerTo(pointer, i))...)
+		}
+	}
+
+	return errs
+}
+
+func (v validator) object(s Schema, obj map[string]any, pointer string) []schemaError {
+	errs := []schemaError{}
+
+	// Missing properties are reported at the pointer they should have been found at
+	for _, name := range s.Required {
+		if _, present := obj[name]; !present {
+			errs = append(errs, schemaError{pointerTo(pointer, name), "is required"})
+		}
+	}
+
+	for _, name := range sortedKeys(obj) {
+		propSchema, isProp := s.Properties[name]
+
+		switch {
+		case isProp:
+			errs = append(errs, v.check(propSchema, obj[name], pointerTo(pointer, name))...)
+		case s.AdditionalProperties == nil:
+			continue
+		case s.AdditionalProperties.Schema != nil:
+			errs = append(errs, v.check(*s.AdditionalProperties.Schema, obj[name], pointerTo(pointer, name))...)
+		case !s.AdditionalProperties.Allowed:
+			errs = append(errs, schemaError{pointerTo(pointer, name), "is not an allowed property"})
+		}
+	}
+
+	return errs
+}
+
+// Check allOf, anyOf, oneOf & not, where the value is checked against several schemas
+func (v validator) composition(s Schema, val any, pointer string) []schemaError {
+	errs := []schemaError{}
+
+	for _, sub := range s.AllOf {
+		errs = append(errs, v.check(sub, val, pointer)...)
+	}
+
+	if len(s.AnyOf) > 0 && v.matches(s.AnyOf, val, pointer) == 0 {
+		errs = append(errs, schemaError{pointer, "must match at least one schema in anyOf"})
+	}
+
+	if len(s.OneOf) > 0 {
+		// With a discriminator the branch is known, so its errors can be reported directly
+		if branch, found := v.discriminatedBranch(s, val); found {
+			errs = append(errs, v.check(branch, val, pointer)...)
+		} else if matched := v.matches(s.OneOf, val, pointer); matched != 1 {
+			errs = append(errs, schemaError{pointer, fmt.Sprintf("must match exactly one schema in oneOf, matched %d", matched)})
+		}
+	}
+
+	if s.Not != nil && len(v.check(*s.Not, val, pointer)) == 0 {
+		errs = append(errs, schemaError{pointer, "must not match the schema in not"})
+	}
+
+	return errs
+}
+
+// Count how many of the schemas a value matches
+func (v validator) matches(schemas []Schema, val any, pointer string) int {
+	matched := 0
+
+	for _, sub := range schemas {
+		if len(v.check(sub, val, pointer)) == 0 {
+			matched++
+		}
+	}
+
+	return matched
+}
+
+// Find the oneOf branch named by the discriminator property of the value, if there is one
+func (v validator) discriminatedBranch(s Schema, val any) (Schema, bool) {
+	obj, isObj := val.(map[string]any)
+	if !isObj || s.Discriminator.PropertyName == "" {
+		return Schema{}, false
+	}
+
+	value, isString := obj[s.Discriminator.PropertyName].(string)
+	if !isString {
+		return Schema{}, false
+	}
+
+	for _, branch := range s.OneOf {
+		if branch.isRef() && s.Discriminator.valueFor(refName(branch.Ref)) == value {
+			return branch, true
+		}
+	}
+
+	return Schema{}, false
+}
+
+// Add a token to a JSON Pointer, escaping as per RFC 6901
+func pointerTo(pointer string, token any) string {
+	escaped := strings.NewReplacer("~", "~0", "/", "~1").Replace(fmt.Sprint(token))
+	return pointer + "/" + escaped
+}
+
+func checkNumber(s Schema, num float64) []string {
+	problems := []string{}
+
+	if lower, exclusive := s.lowerBound(); lower != nil {
+		if num < *lower || (exclusive && num == *lower) {
+			problems = append(problems, boundProblem("greater than", *lower, exclusive))
+		}
+	}
+
+	if upper, exclusive := s.upperBound(); upper != nil {
+		if num > *upper || (exclusive && num == *upper) {
+			problems = append(problems, boundProblem("less than", *upper, exclusive))
+		}
+	}
+
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		if ratio := num / *s.MultipleOf; ratio != float64(int64(ratio)) {
+			problems = append(problems, fmt.Sprintf("must be a multiple of %v", *s.MultipleOf))
+		}
+	}
+
+	return problems
+}
+
+func boundProblem(comparison string, bound float64, exclusive bool) string {
+	if !exclusive {
+		comparison += " or equal to"
+	}
+
+	return fmt.Sprintf("must be %s %v", comparison, bound)
+}
+
+func matchesType(types SchemaType, val any) bool {
+	for _, t := range types {
+		switch t {
+		case "integer":
+			if num, isNum := toFloat(val); isNum && num == float64(int64(num)) {
+				return true
+			}
+		case "number":
+			if _, isNum := toFloat(val); isNum {
+				return true
+			}
+		default:
+			if typeOf(val) == t {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// JSON Schema type name of a decoded value
+func typeOf(val any) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+
+	if _, isNum := toFloat(val); isNum {
+		return "number"
+	}
+
+	return fmt.Sprintf("%T", val)
+}
+
+func inEnum(enum []any, val any) bool {
+	for _, e := range enum {
+		if equalValues(e, val) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Compare decoded values, numbers can come from JSON & YAML as different types so are
+// compared as floats, and arrays & objects are compared deeply
+func equalValues(a, b any) bool {
+	if numA, isNum := toFloat(a); isNum {
+		numB, isNumB := toFloat(b)
+		return isNumB && numA == numB
+	}
+
+	switch valA := a.(type) {
+	case []any:
+		valB, isArray := b.([]any)
+		if !isArray || len(valA) != len(valB) {
+			return false
+		}
+
+		for i := range valA {
+			if !equalValues(valA[i], valB[i]) {
+				return false
+			}
+		}
+
+		return true
+
+	case map[string]any:
+		valB, isObj := b.(map[string]any)
+		if !isObj || len(valA) != len(valB) {
+			return false
+		}
+
+		for key := range valA {
+			if _, present := valB[key]; !present || !equalValues(valA[key], valB[key]) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return a == b
+}
+
+// Find the value a JSON Pointer refers to in a decoded document, as per RFC 6901
+func resolvePointer(doc any, pointer string) (any, bool) {
+	if pointer == "" {
+		return doc, true
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, false
+	}
+
+	current := doc
+
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+
+		switch node := current.(type) {
+		case map[string]any:
+			val, exists := node[token]
+			if !exists {
+				return nil, false
+			}
+
+			current = val
+
+		case []any:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, false
+			}
+
+			current = node[index]
+
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestValidator(t *testing.T) {
+	definitions := map[string]Schema{}
+	if err := json.Unmarshal([]byte(`{
+		"Order": {
+			"type": "object",
+			"required": ["id", "items"],
+			"additionalProperties": false,
+			"properties": {
+				"id": { "type": "string", "pattern": "^ord-[0-9]+$" },
+				"status": { "type": "string", "enum": ["open", "closed"] },
+				"items": { "type": "array", "minItems": 1, "items": { "$ref": "#/definitions/Item" } }
+			}
+		},
+		"Item": {
+			"type": "object",
+			"required": ["price"],
+			"properties": {
+				"price": { "type": "number", "minimum": 0, "exclusiveMinimum": true },
+				"qty": { "type": "integer", "maximum": 10 }
+			}
+		},
+		"Cat": {
+			"type": "object",
+			"required": ["kind", "lives"],
+			"properties": { "kind": { "type": "string" }, "lives": { "type": "integer" } }
+		},
+		"Dog": {
+			"type": "object",
+			"required": ["kind", "bark"],
+			"properties": { "kind": { "type": "string" }, "bark": { "type": "boolean" } }
+		},
+		"Pet": {
+			"oneOf": [{ "$ref": "#/definitions/Cat" }, { "$ref": "#/components/schemas/Dog" }],
+			"discriminator": { "propertyName": "kind", "mapping": { "cat": "#/definitions/Cat" } }
+		},
+		"Loop": {
+			"allOf": [{ "$ref": "#/definitions/Loop" }, { "required": ["id"] }],
+			"properties": { "next": { "$ref": "#/definitions/Loop" } }
+		}
+	}`), &definitions); err != nil {
+		t.Fatal(err)
+	}
+
+	v := newValidator(definitions)
+
+	tests := []struct {
+		name     string
+		schema   string
+		value    string
+		expected []schemaError
+	}{
+		{"valid", `{ "$ref": "#/definitions/Order" }`,
+			`{ "id": "ord-1", "status": "open", "items": [{ "price": 1.5, "qty": 2 }] }`, []schemaError{}},
+		{"type", `{ "type": "string" }`, `12`, []schemaError{{"", "must be of type string, got number"}}},
+		{"integer", `{ "type": "integer" }`, `1.5`, []schemaError{{"", "must be of type integer, got number"}}},
+		{"nullable", `{ "type": "string", "nullable": true }`, `null`, []schemaError{}},
+		{"type_array", `{ "type": ["string", "null"] }`, `null`, []schemaError{}},
+		{"const", `{ "const": "fixed" }`, `"other"`, []schemaError{{"", "must be fixed"}}},
+		{"self_ref", `{ "$ref": "#/definitions/Loop" }`, `{ "id": 1, "next": { "next": {} } }`, []schemaError{
+			{"/next/next/id", "is required"},
+			{"/next/id", "is required"},
+		}},
+		{"nested", `{ "$ref": "#/definitions/Order" }`,
+			`{ "id": "bad", "status": "lost", "items": [{ "price": 1 }, { "price": 0, "qty": 11 }, {}], "x": 1 }`,
+			[]schemaError{
+				{"/id", "must match pattern ^ord-[0-9]+$"},
+				{"/items/1/price", "must be greater than 0"},
+				{"/items/1/qty", "must be less than or equal to 10"},
+				{"/items/2/price", "is required"},
+				{"/status", "must be one of [open closed]"},
+				{"/x", "is not an allowed property"},
+			}},
+		{"required", `{ "$ref": "#/definitions/Order" }`, `{}`, []schemaError{
+			{"/id", "is required"},
+			{"/items", "is required"},
+		}},
+		{"min_items", `{ "$ref": "#/definitions/Order" }`, `{ "id": "ord-1", "items": [] }`, []schemaError{
+			{"/items", "must have at least 1 items"},
+		}},
+		{"pointer_escape", `{ "additionalProperties": { "type": "integer" } }`, `{ "a/b": "x" }`, []schemaError{
+			{"/a~1b", "must be of type integer, got string"},
+		}},
+		{"unique", `{ "type": "array", "uniqueItems": true }`, `[1, 2, 1]`, []schemaError{
+			{"/2", "is a duplicate of item 0"},
+		}},
+		{"tuple", `{ "type": "array", "prefixItems": [{ "type": "string" }], "items": { "type": "integer" } }`,
+			`["a", "b"]`, []schemaError{{"/1", "must be of type integer, got string"}}},
+		{"all_of", `{ "allOf": [{ "$ref": "#/definitions/Item" }, { "required": ["qty"] }] }`, `{ "price": 1 }`,
+			[]schemaError{{"/qty", "is required"}}},
+		{"any_of", `{ "anyOf": [{ "type": "string" }, { "type": "integer" }] }`, `true`,
+			[]schemaError{{"", "must match at least one schema in anyOf"}}},
+		{"one_of", `{ "oneOf": [{ "type": "number" }, { "type": "integer" }] }`, `1`,
+			[]schemaError{{"", "must match exactly one schema in oneOf, matched 2"}}},
+		{"discriminator", `{ "$ref": "#/definitions/Pet" }`, `{ "kind": "cat", "lives": "nine" }`,
+			[]schemaError{{"/lives", "must be of type integer, got string"}}},
+		{"discriminator_model_name", `{ "$ref": "#/definitions/Pet" }`, `{ "kind": "Dog" }`,
+			[]schemaError{{"/bark", "is required"}}},
+		{"not", `{ "not": { "type": "string" } }`, `"x"`, []schemaError{{"", "must not match the schema in not"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var s Schema
+			if err := json.Unmarshal([]byte(test.schema), &s); err != nil {
+				t.Fatal(err)
+			}
+
+			var val any
+			if err := json.Unmarshal([]byte(test.value), &val); err != nil {
+				t.Fatal(err)
+			}
+
+			errs := v.validate(s, val)
+			if len(errs) != len(test.expected) {
+				t.Fatalf("expected %v, got: %v", test.expected, errs)
+			}
+
+			for i := range errs {
+				if errs[i] != test.expected[i] {
+					t.Errorf("expected %v, got: %v", test.expected[i], errs[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Lint subcommand, checks a spec for problems before serving it
+// ----------------------------------------------------------------------------
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+)
+
+// A problem found in a spec, the path is the keys from the root of the document
+type lintIssue struct {
+	path    []string
+	message string
+	line    int
+	column  int
+}
+
+// Checks a single spec file, both the raw document & the parsed model are used
+type linter struct {
+	raw    any
+	file   *ast.File
+	spec   OpenAPIv2
+	isV3   bool
+	refs   *refResolver
+	issues []lintIssue
+
+	// Values in other files which have been checked for refs, keyed by absolute ref
+	followed map[string]bool
+}
+
+// Entry point for `mockery lint`, returns the exit code
+func runLint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	specFile := flags.String("file", "", "OpenAPI spec file in JSON or YAML format")
+	flags.StringVar(specFile, "f", "", "OpenAPI spec file in JSON or YAML format")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: mockery lint [-f] <spec file>...")
+		flags.PrintDefaults()
+	}
+
+	_ = flags.Parse(args)
+
+	files := flags.Args()
+	if *specFile != "" {
+		files = append([]string{*specFile}, files...)
+	}
+
+	if len(files) == 0 {
+		flags.Usage()
+		return 2
+	}
+
+	problems := 0
+
+	for _, filePath := range files {
+		issues, err := lintSpec(filePath)
+		if err != nil {
+			fmt.Printf("%s: %s\n", filePath, err)
+			problems++
+
+			continue
+		}
+
+		for _, issue := range issues {
+			fmt.Printf("%s:%d:%d: %s\n", filePath, issue.line, issue.column, issue.message)
+		}
+
+		problems += len(issues)
+	}
+
+	if problems > 0 {
+		fmt.Printf("\n%d problem(s) found\n", problems)
+		return 1
+	}
+
+	fmt.Println("No problems found")
+
+	return 0
+}
+
+// Check a spec file, returning all the issues found sorted by position
+// An error is returned if the file can't be loaded & parsed at all
+func lintSpec(filePath string) ([]lintIssue, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &linter{
+		refs:     &refResolver{rootFile: absPath, cache: map[string]any{}},
+		followed: map[string]bool{},
+	}
+
+	if err := loadSpecFile(filePath, &l.raw); err != nil {
+		return nil, err
+	}
+
+	if rawMap, isMap := l.raw.(map[string]any); isMap {
+		_, l.isV3 = rawMap["openapi"]
+	}
+
+	// The AST is only used for positions, so failing to parse it isn't fatal
+	if data, err := os.ReadFile(filePath); err == nil {
+		l.file, _ = parser.ParseBytes(data, 0)
+	}
+
+	l.checkRefs(l.raw, []string{}, absPath, ctxOther)
+
+	// A spec with broken refs to other files can't be parsed, so just report the refs
+	if l.spec, err = ParseSpec(filePath); err != nil && len(l.issues) == 0 {
+		return nil, err
+	}
+
+	if err == nil {
+		l.checkPaths()
+		l.checkDefinitions()
+	}
+
+	for i := range l.issues {
+		l.issues[i].line, l.issues[i].column = l.position(l.issues[i].path)
+	}
+
+	sort.SliceStable(l.issues, func(i, j int) bool {
+		if l.issues[i].line != l.issues[j].line {
+			return l.issues[i].line < l.issues[j].line
+		}
+
+		return l.issues[i].column < l.issues[j].column
+	})
+
+	return l.issues, nil
+}
+
+// Copy of a path with more keys added, so paths can be kept without sharing arrays
+func extend(path []string, keys ...string) []string {
+	return append(append([]string{}, path...), keys...)
+}
+
+func (l *linter) report(path []string, format string, args ...any) {
+	l.issues = append(l.issues, lintIssue{
+		path:    path,
+		message: fmt.Sprintf(format, args...),
+	})
+}
+
+// Walk the whole raw document looking for refs that point at nothing, including
+// refs to other files, which are loaded to check the pointer. Values in other files
+// are checked too, with any issues reported at the ref in the root document
+func (l *linter) checkRefs(node any, path []string, file string, ctx refContext) {
+	// Examples & other data can have keys called $ref, which aren't refs
+	if ctx == ctxLiteral {
+		return
+	}
+
+	switch n := node.(type) {
+	case map[string]any:
+		for _, key := range sortedKeys(n) {
+			childPath := path
+			if file == l.refs.rootFile {
+				childPath = extend(path, key)
+			}
+
+			// In a map of schemas $ref is just a name, e.g. a property called $ref
+			ref, isString := n[key].(string)
+			if key != "$ref" || !isString || ctx == ctxSchemaMap {
+				l.checkRefs(n[key], childPath, file, childContext(ctx, key, l.isV3))
+				continue
+			}
+
+			l.checkRef(ref, childPath, file, ctx)
+		}
+
+	case []any:
+		itemCtx := ctx
+		if ctx == ctxSchemaList {
+			itemCtx = ctxSchema
+		}
+
+		for i, item := range n {
+			itemPath := path
+			if file == l.refs.rootFile {
+				itemPath = extend(path, strconv.Itoa(i))
+			}
+
+			l.checkRefs(item, itemPath, file, itemCtx)
+		}
+	}
+}
+
+// Check a single ref resolves, following it if it points into another file
+func (l *linter) checkRef(ref string, path []string, file string, ctx refContext) {
+	// Refs in other files say which file they are in, as the path is of the root ref
+	where := ""
+	if file != l.refs.rootFile {
+		relPath, err := filepath.Rel(filepath.Dir(l.refs.rootFile), file)
+		if err != nil {
+			relPath = file
+		}
+
+		where = " in " + relPath
+	}
+
+	targetFile, pointer, err := l.refs.split(ref, file)
+	if err != nil {
+		l.report(path, "%s%s", err, where)
+		return
+	}
+
+	target, found, err := l.refs.target(targetFile, pointer)
+	if err != nil {
+		l.report(path, "$ref '%s'%s file can not be loaded: %s", ref, where, errors.Unwrap(err))
+		return
+	}
+
+	if !found {
+		l.report(path, "$ref '%s'%s does not resolve to anything", ref, where)
+		return
+	}
+
+	// The root document is walked anyway, & each value elsewhere is only checked once
+	key := targetFile + "#" + pointer
+	if targetFile == l.refs.rootFile || l.followed[key] {
+		return
+	}
+
+	l.followed[key] = true
+	l.checkRefs(target, path, targetFile, ctx)
+}
+
+// Check the paths & operations, including the examples in responses
+func (l *linter) checkPaths() {
+	operationIDs := map[string]string{}
+
+	for _, path := range sortedKeys(l.spec.Paths) {
+		if !strings.HasPrefix(path, "/") {
+			l.report([]string{"paths", path}, "path '%s' does not start with '/' and will not be served", path)
+			continue
+		}
+
+		ops := l.spec.Paths[path].operations()
+
+		for _, method := range httpMethods {
+			op, defined := ops[method]
+			if !defined {
+				continue
+			}
+
+			opPath := []string{"paths", path, strings.ToLower(method)}
+			name := method + " " + path
+
+			if op.OperationID != "" {
+				if first, exists := operationIDs[op.OperationID]; exists {
+					l.report(extend(opPath, "operationId"), "operationId '%s' is also used by %s", op.OperationID, first)
+				} else {
+					operationIDs[op.OperationID] = name
+				}
+			}
+
+			hasSuccess := false
+
+			for _, status := range sortedKeys(op.Responses) {
+				// The default response is often used for success, so counts as one
+				hasSuccess = hasSuccess || strings.HasPrefix(status, "2") || status == "default"
+				l.checkResponse(extend(opPath, "responses", status), op.Responses[status])
+			}
+
+			if !hasSuccess {
+				l.report(extend(opPath, "responses"), "%s has no 2xx response", name)
+			}
+		}
+	}
+}
+
+// Check the examples of a response match its schema
+func (l *linter) checkResponse(path []string, resp Response) {
+	v := newValidator(l.spec.Definitions)
+
+	for _, mediaType := range sortedKeys(resp.Examples) {
+		example := resp.Examples[mediaType]
+		if _, isString := example.(string); resp.Schema.isEmpty() || (isString && !isJSON(mediaType)) {
+			continue
+		}
+
+		// For v3 this can be a copy of the first named example, which is checked below
+		if l.isV3 && isNamedExample(resp, example) {
+			continue
+		}
+
+		examplePath := extend(path, "examples", mediaType)
+		if l.isV3 {
+			examplePath = extend(path, "content", mediaType, "example")
+		}
+
+		l.reportErrors(examplePath, "example", v.validate(resp.Schema, example))
+	}
+
+	for _, name := range sortedKeys(resp.NamedExamples) {
+		if resp.Schema.isEmpty() {
+			break
+		}
+
+		examplePath := extend(path, "x-examples", name)
+		if l.isV3 && len(resp.Produces) > 0 {
+			examplePath = extend(path, "content", resp.Produces[0], "examples", name, "value")
+		}
+
+		l.reportErrors(examplePath, "example '"+name+"'", v.validate(resp.Schema, resp.NamedExamples[name]))
+	}
+
+	schemaPath := extend(path, "schema")
+	if l.isV3 && len(resp.Produces) > 0 {
+		schemaPath = extend(path, "content", resp.Produces[0], "schema")
+	}
+
+	l.checkSchema(schemaPath, resp.Schema)
+}
+
+func isNamedExample(resp Response, example any) bool {
+	for _, named := range resp.NamedExamples {
+		if equalValues(named, example) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Check the examples in the models
+func (l *linter) checkDefinitions() {
+	for _, name := range sortedKeys(l.spec.Definitions) {
+		path := []string{"definitions", name}
+		if l.isV3 {
+			path = []string{"components", "schemas", name}
+		}
+
+		l.checkSchema(path, l.spec.Definitions[name])
+	}
+}
+
+// Check the examples of a schema & its properties & items match the schema
+func (l *linter) checkSchema(path []string, s Schema) {
+	if s.isRef() {
+		return
+	}
+
+	v := newValidator(l.spec.Definitions)
+
+	if s.Example != nil {
+		l.reportErrors(extend(path, "example"), "example", v.validate(s, s.Example))
+	}
+
+	for i, example := range s.Examples {
+		l.reportErrors(extend(path, "examples", strconv.Itoa(i)), "example", v.validate(s, example))
+	}
+
+	for _, name := range sortedKeys(s.Properties) {
+		l.checkSchema(extend(path, "properties", name), s.Properties[name])
+	}
+
+	if s.Items != nil {
+		l.checkSchema(extend(path, "items"), *s.Items)
+	}
+}
+
+func (l *linter) reportErrors(path []string, what string, errs []schemaError) {
+	for _, err := range errs {
+		l.report(path, "%s does not match schema: %s", what, err)
+	}
+}
+
+// Line & column of the node at a path in the document, if the full path can't
+// be found the position of the closest parent is used
+func (l *linter) position(path []string) (int, int) {
+	if l.file == nil || len(l.file.Docs) == 0 {
+		return 0, 0
+	}
+
+	node := locateNode(l.file.Docs[0].Body, path)
+	if node == nil || node.GetToken() == nil {
+		return 0, 0
+	}
+
+	return node.GetToken().Position.Line, node.GetToken().Position.Column
+}
+
+func locateNode(node ast.Node, path []string) ast.Node {
+	if len(path) == 0 || node == nil {
+		return node
+	}
+
+	switch n := node.(type) {
+	case *ast.MappingNode:
+		for _, mapValue := range n.Values {
+			if mapValue.Key.GetToken().Value == path[0] {
+				return locateNode(mapValue, path)
+			}
+		}
+
+	case *ast.MappingValueNode:
+		if n.Key.GetToken().Value != path[0] {
+			return nil
+		}
+
+		if child := locateNode(n.Value, path[1:]); child != nil && len(path) > 1 {
+			return child
+		}
+
+		return n.Key
+
+	case *ast.SequenceNode:
+		index, err := strconv.Atoi(path[0])
+		if err != nil || index < 0 || index >= len(n.Values) {
+			return nil
+		}
+
+		if child := locateNode(n.Values[index], path[1:]); child != nil && len(path) > 1 {
+			return child
+		}
+
+		return n.Values[index]
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write([]byte(`openapi: "3.0.3"
+info:
+  title: Bad
+  version: "1"
+paths:
+  /things:
+    get:
+      operationId: getThings
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Thing"
+              examples:
+                one:
+                  value: { id: "abc" }
+    post:
+      operationId: getThings
+      responses:
+        "400":
+          description: Bad
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Missing"
+  things/{id}:
+    get:
+      responses:
+        "200":
+          description: OK
+components:
+  schemas:
+    Thing:
+      type: object
+      properties:
+        id:
+          type: integer
+          example: "oops"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tempFile.Close()
+
+	issues, err := lintSpec(tempFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []lintIssue{
+		{nil, "example 'one' does not match schema: /id must be of type integer, got string", 18, 19},
+		{nil, "operationId 'getThings' is also used by GET /things", 20, 7},
+		{nil, "POST /things has no 2xx response", 21, 7},
+		{nil, "$ref '#/components/schemas/Missing' does not resolve to anything", 27, 17},
+		{nil, "path 'things/{id}' does not start with '/' and will not be served", 28, 3},
+		{nil, "example does not match schema: must be of type integer, got string", 40, 11},
+	}
+
+	if len(issues) != len(expected) {
+		t.Fatalf("expected %d issues, got: %v", len(expected), issues)
+	}
+
+	for i, issue := range issues {
+		if issue.message != expected[i].message || issue.line != expected[i].line || issue.column != expected[i].column {
+			t.Errorf("expected %d:%d %s, got: %d:%d %s", expected[i].line, expected[i].column, expected[i].message,
+				issue.line, issue.column, issue.message)
+		}
+	}
+
+	t.Run("clean", func(t *testing.T) {
+		issues, err := lintSpec("../samples/petstore-v3.yaml")
+		if err != nil || len(issues) != 0 {
+			t.Errorf("expected no issues, got: %v %v", issues, err)
+		}
+	})
+
+	t.Run("default_response", func(t *testing.T) {
+		issues, err := lintSpec("../samples/petstore.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Operations like POST /user only have a default response
+		for _, issue := range issues {
+			if strings.HasPrefix(issue.message, "POST /user ") || strings.HasPrefix(issue.message, "GET /user/logout ") {
+				t.Errorf("expected default response to count as success, got: %s", issue.message)
+			}
+		}
+	})
+
+	t.Run("json_positions", func(t *testing.T) {
+		issues, err := lintSpec("../samples/basic.json")
+		if err != nil || len(issues) == 0 || issues[0].line != 30 {
+			t.Errorf("expected issue on line 30, got: %v %v", issues, err)
+		}
+	})
+
+	t.Run("refs", func(t *testing.T) {
+		dir := writeSpecFiles(t, map[string]string{
+			"spec.yaml": `
+swagger: "2.0"
+info: { title: x, version: "1" }
+paths:
+  /pets:
+    get:
+      responses:
+        "200":
+          description: OK
+          schema:
+            $ref: "models/pet.yaml#/Pet"
+          examples:
+            application/json: { "$ref": "not a ref" }
+definitions:
+  Thing:
+    type: object
+    example: { "$ref": "#/nowhere" }
+    enum: [{ "$ref": "#/nowhere" }]
+`,
+			"models/pet.yaml": `
+Pet:
+  type: object
+  properties:
+    owner:
+      $ref: "#/Owner"
+`,
+		})
+
+		issues, err := lintSpec(filepath.Join(dir, "spec.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Only the ref in the other file is broken, the rest are examples
+		expected := "$ref '#/Owner' in " + filepath.Join("models", "pet.yaml") + " does not resolve to anything"
+		if len(issues) != 1 || issues[0].message != expected || issues[0].line != 11 {
+			t.Errorf("expected one issue for the ref in the other file, got: %v", issues)
+		}
+	})
+}
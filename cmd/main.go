@@ -7,7 +7,6 @@ package main
 
 import (
 	"crypto/tls"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -15,28 +14,91 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/cors"
 	"github.com/lmittmann/tint"
 	"moul.io/banner"
 )
 
 type Config struct {
-	specFile string
-	port     int
-	logLevel slog.Level
-	apiKey   string
-	certPath string
+	specFiles      listFlag
+	port           int
+	adminPort      int
+	logLevel       slog.Level
+	apiKey         string
+	adminKey       string
+	certPath       string
+	maxDepth       int
+	fake           bool
+	seed           int64
+	seedPath       bool
+	examples       string
+	validate       bool
+	checkResponses string
+	watch          bool
+	stateful       bool
+	storeFile      string
+	fixtures       string
+	journalSize    int
+	proxyTarget    string
+	record         string
+	playback       string
+	mockTags       listFlag
+	mockOps        listFlag
 }
 
 const contentType = "application/json"
 
+// Strategies for picking a named example when the caller doesn't ask for one
+const (
+	strategyFirst      = "first"
+	strategyRandom     = "random"
+	strategyRoundRobin = "round-robin"
+)
+
+// Modes for checking responses against their own schema
+const (
+	checkOff  = "off"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// All the HTTP methods an OpenAPI path can define, in the order routes are added
+var httpMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete,
+	http.MethodPatch, http.MethodHead, http.MethodOptions, http.MethodTrace,
+}
+
+// Purely cosmetic, used when logging the routes being added
+var methodIcons = map[string]string{
+	http.MethodGet:     "🔵",
+	http.MethodPost:    "🟢",
+	http.MethodPut:     "🟠",
+	http.MethodDelete:  "🔴",
+	http.MethodPatch:   "🟣",
+	http.MethodHead:    "⚪",
+	http.MethodOptions: "🟤",
+	http.MethodTrace:   "⚫",
+}
+
 // Globals, so sue me
 var logger *slog.Logger
-var spec OpenAPIv2
+var config = Config{
+	specFiles:      nil,
+	port:           8000,
+	logLevel:       slog.LevelInfo,
+	apiKey:         "",
+	certPath:       "",
+	maxDepth:       10,
+	fake:           false,
+	seed:           0,
+	seedPath:       false,
+	examples:       strategyFirst,
+	checkResponses: checkOff,
+	journalSize:    1000,
+}
 
 func init() {
 	// Fall back logger, if no config is loaded
@@ -47,125 +109,63 @@ func init() {
 
 // Main entry point
 func main() {
-	fmt.Println(banner.Inline("mockery"))
+	// Subcommands have their own flags, so are handled before any config
+	if len(os.Args) > 1 && (os.Args[1] == "lint" || os.Args[1] == "validate") {
+		os.Exit(runLint(os.Args[2:]))
+	}
 
-	var config = Config{
-		specFile: "",
-		port:     8000,
-		logLevel: slog.LevelInfo,
-		apiKey:   "",
-		certPath: "",
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		os.Exit(runContractTests(os.Args[2:]))
 	}
 
+	fmt.Println(banner.Inline("mockery"))
+
 	// Populate config from command line flags and environment variables
 	config.process()
 
-	if config.specFile == "" {
+	if len(config.specFiles) == 0 {
 		logger.Error("No OpenAPI spec file specified, please use -file or -f")
 		os.Exit(1)
 	}
 
-	// Load spec file
-	logger.Info("Will try to load spec document: " + config.specFile)
-	var err error
-	spec, err = ParseV2Spec(config.specFile)
+	// Load all the spec files, there can be more than one
+	apis, err := loadAPIs(config.specFiles)
 	if err != nil {
 		logger.Error("Failed to parse OpenAPI spec file:", tint.Err(err))
 		os.Exit(1)
 	}
 
-	// The main router used by the server for all requests
-	router := chi.NewRouter()
-
-	// Handle base path
-	basePath := spec.BasePath
-
-	// If base path doesn't start with a slash it's malformed
-	if basePath == "" || basePath[:1] != "/" {
-		logger.Warn("Base path maybe invalid or empty", slog.Any("basePath", basePath))
-		basePath = "/"
-	}
-
-	if basePath[len(basePath)-1:] == "/" {
-		basePath = basePath[:len(basePath)-1]
+	for _, api := range apis {
+		logger.Warn("Starting Mockery", slog.Any("title", api.title()), slog.Any("version", api.version()),
+			slog.Any("basePath", api.basePath+"/"))
 	}
 
-	// Get some details from the spec
-	title := "Untitled API"
-	version := "0.0.0"
-	if spec.Info.Title != "" {
-		title = spec.Info.Title
-	}
-	if spec.Info.Version != "" {
-		version = spec.Info.Version
-	}
-
-	logger.Warn("Starting Mockery", slog.Any("title", title), slog.Any("version", version))
-
-	// Ignore *all* CORS, this is a mock server after all
-	cors := cors.AllowAll()
-	router.Use(cors.Handler)
-
-	// Add server headers
-	router.Use(middleware.SetHeader("Server", fmt.Sprintf("Mockery: %s v%s", spec.Info.Title, spec.Info.Version)))
-
-	// Custom not found handler
-	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
-		logger.Error("Not found", slog.Any("path", r.URL.Path))
-		w.WriteHeader(404)
-	})
-
-	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		_, _ = w.Write([]byte("Mockery - " + title + " v" + version + "\n"))
-	})
-
-	// Check for x-api-key header if auth is enabled
-	if config.apiKey != "" {
-		router.Use(func(next http.Handler) http.Handler {
-			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				if r.Header.Get("x-api-key") == "" {
-					logger.Error("Not authorised, missing API key")
-					w.WriteHeader(401)
-					return
-				}
-
-				if r.Header.Get("x-api-key") != config.apiKey {
-					logger.Error("Invalid API key")
-					w.WriteHeader(401)
-					return
-				}
-
-				next.ServeHTTP(w, r)
-			})
-		})
+	if config.fake {
+		logger.Info("Fake data enabled", slog.Any("seed", config.seed), slog.Any("seedPath", config.seedPath))
 	}
 
-	// Loop over all paths
-	for path, pathSpec := range spec.Paths {
-		if path[:1] != "/" {
-			continue
+	if config.stateful {
+		if err := setupStore(); err != nil {
+			logger.Error("Failed to set up stateful mode:", tint.Err(err))
+			os.Exit(1)
 		}
 
-		fullPath := basePath + path
-		if pathSpec.isGet() {
-			logger.Info("🔵 Adding GET route", slog.Any("path", fullPath))
-			router.Get(fullPath, createResponseHandler(pathSpec.Get))
-		}
+		logger.Info("Stateful mode enabled", slog.Any("storeFile", config.storeFile), slog.Any("fixtures", config.fixtures))
+	}
 
-		if pathSpec.isPost() {
-			logger.Info("🟢 Adding POST route", slog.Any("path", fullPath))
-			router.Post(fullPath, createResponseHandler(pathSpec.Post))
-		}
+	if err := setupProxy(); err != nil {
+		logger.Error("Failed to set up proxy:", tint.Err(err))
+		os.Exit(1)
+	}
 
-		if pathSpec.isPut() {
-			logger.Info("🟠 Adding PUT route", slog.Any("path", fullPath))
-			router.Put(fullPath, createResponseHandler(pathSpec.Put))
-		}
+	if config.proxyTarget != "" {
+		logger.Info("Proxying requests", slog.Any("target", config.proxyTarget), slog.Any("record", config.record))
+	}
 
-		if pathSpec.isDelete() {
-			logger.Info("🔴 Adding DELETE route", slog.Any("path", fullPath))
-			router.Delete(fullPath, createResponseHandler(pathSpec.Delete))
-		}
+	router, err := newRouter(apis)
+	if err != nil {
+		logger.Error("Failed to add routes:", tint.Err(err))
+		os.Exit(1)
 	}
 
 	useTLS := false
@@ -190,17 +190,40 @@ func main() {
 		}
 	}
 
-	// Create custom server
-	srv := &http.Server{
-		Addr:         fmt.Sprintf(":%d", config.port),
-		Handler:      router,
+	// Routes are served through a handler which can be swapped when the specs change
+	handler := newSwappableHandler(router, apis)
+	if config.watch {
+		go newWatcher(config.specFiles, handler).run()
+	}
+
+	// Admin API on its own port, so it can be kept away from clients of the mock
+	if config.adminPort != 0 {
+		adminRouter := chi.NewRouter()
+		adminRouter.Mount(adminPrefix, newAdminRouter(handler.apis))
+
+		logger.Warn("Admin API started", slog.Any("port", config.adminPort))
+
+		go serve(newServer(config.adminPort, adminRouter), useTLS)
+	}
+
+	logger.Warn("Mockery server started", slog.Any("port", config.port), slog.Any("tls", useTLS))
+
+	serve(newServer(config.port, handler), useTLS)
+}
+
+// Create custom server
+func newServer(port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         fmt.Sprintf(":%d", port),
+		Handler:      handler,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  120 * time.Second,
 	}
+}
 
-	logger.Warn("Mockery server started", slog.Any("port", config.port), slog.Any("tls", useTLS))
-
+// Start listening, this only returns if the server fails, which ends the process
+func serve(srv *http.Server, useTLS bool) {
 	// If TLS is enabled, start using ListenAndServeTLS
 	if useTLS {
 		srv.TLSConfig = &tls.Config{
@@ -220,20 +243,93 @@ func main() {
 	}
 }
 
+// Count of requests for each response, used to rotate through named examples
+// Shared by all handlers, so the counts can be reset with the admin API
+type responseCounters struct {
+	lock   sync.Mutex
+	counts map[string]int
+}
+
+var counters = &responseCounters{counts: map[string]int{}}
+
+// The count for a response before this request, which is then added to it
+func (c *responseCounters) next(key string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	count := c.counts[key]
+	c.counts[key]++
+
+	return count
+}
+
+func (c *responseCounters) reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.counts = map[string]int{}
+}
+
 // This is the heart of the mocking server, it creates a handler function for a given operation
 // The handler function will return a response based on the operation's responses
 // And will try to construct a response payload from examples in the spec
-func createResponseHandler(op Operation) http.HandlerFunc {
+func createResponseHandler(route mockRoute) http.HandlerFunc {
+	api, op := route.api, route.op
 	logger.Debug("   Creating handler", slog.Any("id", op.OperationID), slog.Any("title", op.Description))
 
+	// Paths which are collections or items are handled by the store in stateful mode
+	var res *resource
+	if config.stateful {
+		res = findResource(api.spec.Paths, route.path)
+	}
+
+	// Recorded responses are kept under this name when proxying, and used in playback
+	recName := recordingName(route)
+
+	// Counts are kept for each response of the route, two APIs can't serve the same route
+	counterKey := route.method + " " + api.basePath + route.path + " "
+
 	return func(w http.ResponseWriter, r *http.Request) {
 		logger.Info("Request", slog.Any("method", r.Method), slog.Any("path", r.URL.Path),
 			slog.Any("id", op.OperationID))
 
+		if e := journalEntryFor(r); e != nil {
+			e.OperationID = op.OperationID
+		}
+
+		// The upstream sends the real response when proxying, unless the operation is picked to be mocked
+		if upstream != nil && !isMocked(op) {
+			proxyRequest(w, r, recName)
+			return
+		}
+
+		// Reject requests that don't match the spec, before any response is picked
+		if config.validate {
+			if violations := validateRequest(r, op.Parameters, api.spec.Definitions); len(violations) > 0 {
+				logger.Warn("Request failed validation", slog.Any("violations", len(violations)))
+				writeProblem(w, r, http.StatusBadRequest,
+					fmt.Sprintf("Request does not match the spec, %d violation(s) found", len(violations)), violations)
+
+				return
+			}
+		}
+
 		// Get x-mock-response-code header which allows caller to request a specific response
 		requestedCode := r.Header.Get("x-mock-response-code")
 		if requestedCode != "" {
 			logger.Info("Requested response code", slog.Any("code", requestedCode))
+
+			if !validStatus(requestedCode) {
+				writeProblem(w, r, http.StatusBadRequest,
+					fmt.Sprintf("x-mock-response-code '%s' is not a status code between 100 & 599", requestedCode), nil)
+
+				return
+			}
+		}
+
+		// Resources are kept in the store, unless the caller wants a specific response
+		if res != nil && requestedCode == "" && res.handle(w, r, route) {
+			return
 		}
 
 		// Path to discover which response to use
@@ -242,63 +338,196 @@ func createResponseHandler(op Operation) http.HandlerFunc {
 			expectedStatus, _ = strconv.Atoi(requestedCode)
 		}
 
-		respIndex := strconv.Itoa(expectedStatus)
-		statusCode := expectedStatus
+		// Recorded responses are preferred over anything from the spec
+		if config.playback != "" {
+			wantStatus := 0
+			if requestedCode != "" {
+				wantStatus = expectedStatus
+			}
 
-		resp, respExists := op.Responses[respIndex]
-		if !respExists {
-			// No matching response, fall back to first one in map
-			logger.Warn("No response matching status, falling back to first response",
-				slog.Any("requested_code", requestedCode))
+			if rec := recordings.find(recName, r, wantStatus); rec != nil {
+				logger.Debug("Returning recorded response", slog.Any("status", rec.Response.Status))
+				rec.respond(w)
 
-			for respName := range op.Responses {
-				respIndex = respName
-				statusCode, _ = strconv.Atoi(respName)
-				resp = op.Responses[respName]
-				break
+				return
 			}
 		}
 
+		respIndex, statusCode := op.pickResponse(expectedStatus, requestedCode != "")
+		resp := op.Responses[respIndex]
+
 		// Mutate the response object to add the status code, as a convenience
 		resp.StatusCode = statusCode
 
+		// Work out the media type to return from the Accept header, before anything is built for the response
+		produces := op.producesFor(resp, api.spec.Produces)
+
+		mediaType, acceptable := negotiate(r.Header.Get("Accept"), produces)
+		if !acceptable {
+			logger.Error("Not acceptable", slog.Any("accept", r.Header.Get("Accept")), slog.Any("produces", produces))
+			w.WriteHeader(http.StatusNotAcceptable)
+
+			return
+		}
+
+		// Caller can pick which oneOf/anyOf branch to use with x-mock-variant header
+		gen := newGenerator(api.spec.Definitions)
+		gen.variant = r.Header.Get("x-mock-variant")
+		gen.mediaType = mediaType
+
+		if config.seedPath {
+			gen.seedFromPath(r.URL.Path)
+		}
+
+		// Caller can pick a named example with x-mock-example header or query parameter
+		gen.example = r.Header.Get("x-mock-example")
+		if gen.example == "" {
+			gen.example = r.URL.Query().Get("x-mock-example")
+		}
+
+		gen.sequence = counters.next(counterKey + respIndex)
+
 		// This starts the payload & example discovery process
-		payload := resp.parse()
+		payload := resp.parseWith(gen)
+
+		// Add any headers the response declares
+		for name, val := range resp.headerValues(gen, r.URL.Path, payload) {
+			w.Header().Set(name, val)
+		}
 
 		// Finally return the response with or without payload
-		if payload != nil {
-			logger.Debug("Returning example payload")
-			w.Header().Set("Content-Type", contentType)
-			w.WriteHeader(statusCode)
-			_ = json.NewEncoder(w).Encode(payload)
-		} else {
+		if payload == nil {
 			logger.Warn("No example found, response will be empty", slog.Any("status", respIndex))
 			w.WriteHeader(statusCode)
+
+			return
+		}
+
+		// Check the payload against its own schema, to find broken examples in the spec
+		if config.checkResponses != checkOff {
+			if errs := checkResponse(resp, payload, mediaType, api.spec.Definitions); len(errs) > 0 {
+				violations := []violation{}
+
+				for _, schemaErr := range errs {
+					logger.Warn("Response does not match schema", slog.Any("status", respIndex),
+						slog.Any("error", schemaErr.String()))
+					w.Header().Add("x-mock-warnings", schemaErr.String())
+					violations = append(violations, violation{"response", respIndex, schemaErr.Pointer, schemaErr.Detail})
+				}
+
+				if config.checkResponses == checkFail {
+					writeProblem(w, r, http.StatusInternalServerError,
+						fmt.Sprintf("Response does not match the spec, %d violation(s) found", len(violations)), violations)
+
+					return
+				}
+			}
+		}
+
+		body, err := encodePayload(mediaType, payload, resp.Schema, api.spec.Definitions)
+		if err != nil {
+			logger.Error("Failed to encode payload", slog.Any("mediaType", mediaType), slog.Any("error", err))
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		logger.Debug("Returning example payload", slog.Any("mediaType", mediaType))
+		w.Header().Set("Content-Type", mediaType)
+		w.WriteHeader(statusCode)
+		_, _ = w.Write(body)
+	}
+}
+
+// Handler for OPTIONS requests on paths where the spec doesn't define the operation
+func createOptionsHandler(allowed []string) http.HandlerFunc {
+	allowHeader := strings.Join(allowed, ", ")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger.Info("Request", slog.Any("method", r.Method), slog.Any("path", r.URL.Path))
+
+		w.Header().Set("Allow", allowHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// List of methods allowed on a path, including the implicit HEAD & OPTIONS
+func allowedMethods(ops map[string]Operation) []string {
+	allowed := []string{}
+	_, hasGet := ops[http.MethodGet]
+
+	for _, method := range httpMethods {
+		_, defined := ops[method]
+
+		switch {
+		case defined:
+			allowed = append(allowed, method)
+		case method == http.MethodHead && hasGet:
+			allowed = append(allowed, method)
+		case method == http.MethodOptions:
+			allowed = append(allowed, method)
 		}
 	}
+
+	return allowed
 }
 
 // Process command line flags and environment variables to build config
 func (c *Config) process() {
 	// Command line flags
 	var levelString string
-	flag.StringVar(&c.specFile, "file", "", "OpenAPI spec file in JSON or YAML format. REQUIRED")
-	flag.StringVar(&c.specFile, "f", "", "OpenAPI spec file in JSON or YAML format. REQUIRED")
+	specUsage := "OpenAPI spec file in JSON or YAML format, or a directory or glob of them. " +
+		"Can be repeated, add =/prefix to mount under a path other than the base path. REQUIRED"
+	flag.Var(&c.specFiles, "file", specUsage)
+	flag.Var(&c.specFiles, "f", specUsage)
 	flag.IntVar(&c.port, "port", 8000, "Port to run mock server on")
 	flag.StringVar(&levelString, "log-level", "info", "Log level: debug, info, warn, error")
 	flag.StringVar(&c.apiKey, "api-key", "", "Enable API key authentication")
+	flag.StringVar(&c.adminKey, "admin-key", "", "Require this key in the x-admin-key header for the admin API")
+	flag.IntVar(&c.adminPort, "admin-port", 0, "Port to run the admin API on, the same port as the mock if not set")
 	flag.StringVar(&c.certPath, "cert-path", "", "Path to directory wth cert.pem & key.pem to enable TLS")
+	flag.IntVar(&c.maxDepth, "max-depth", 10, "Max depth of nested objects & arrays in generated payloads")
+	flag.BoolVar(&c.fake, "fake", false, "Generate realistic fake data for fields without examples")
+	flag.Int64Var(&c.seed, "seed", 0, "Seed for fake data, the same seed gives the same data. Random if not set")
+	flag.StringVar(&c.examples, "examples", strategyFirst, "How to pick a named example: first, random, round-robin")
+	flag.StringVar(&c.checkResponses, "check-responses", checkOff,
+		"Check responses match their schema: off, warn (log & add x-mock-warnings header), fail (return 500)")
+	flag.BoolVar(&c.validate, "validate", false, "Validate requests against the spec, returning 400 when invalid")
+	flag.StringVar(&c.storeFile, "store-file", "", "JSON file to keep stateful resources in, so they survive restarts")
+	flag.StringVar(&c.fixtures, "fixtures", "",
+		"Directory of JSON or YAML files with resources to start stateful mode with")
+	flag.BoolVar(&c.stateful, "stateful", false, "Store resources sent with POST, PUT & PATCH, so they can be fetched")
+	flag.StringVar(&c.proxyTarget, "proxy-target", "", "URL of a real API to send requests to, instead of mocking them")
+	flag.StringVar(&c.record, "record", "", "Directory to record responses from the proxy target in")
+	flag.StringVar(&c.playback, "playback", "", "Directory of recorded responses, which are used before the spec")
+	flag.Var(&c.mockTags, "mock-tags", "When proxying, mock operations with this tag instead. Can be repeated")
+	flag.Var(&c.mockOps, "mock-ops", "When proxying, mock the operation with this operationId instead. Can be repeated")
+	flag.IntVar(&c.journalSize, "journal-size", 1000, "Requests to keep in the journal, 0 turns it off")
+	flag.BoolVar(&c.watch, "watch", false, "Watch the spec files & files they reference, reloading them when changed")
+	flag.BoolVar(&c.seedPath, "seed-path", false,
+		"Also seed fake data with the request path, so a path is always the same")
 	flag.Parse()
 
+	// Spec files can also be given without a flag, e.g. when a glob is expanded by the shell
+	c.specFiles = append(c.specFiles, flag.Args()...)
+
 	// Environment variables can override command line flags
 	if os.Getenv("SPEC_FILE") != "" {
-		c.specFile = os.Getenv("SPEC_FILE")
+		c.specFiles = strings.Split(os.Getenv("SPEC_FILE"), ",")
 	}
 
 	if os.Getenv("API_KEY") != "" {
 		c.apiKey = os.Getenv("API_KEY")
 	}
 
+	if os.Getenv("ADMIN_KEY") != "" {
+		c.adminKey = os.Getenv("ADMIN_KEY")
+	}
+
+	if adminPort, err := strconv.Atoi(os.Getenv("ADMIN_PORT")); err == nil {
+		c.adminPort = adminPort
+	}
+
 	if os.Getenv("CERT_PATH") != "" {
 		c.certPath = os.Getenv("CERT_PATH")
 	}
@@ -307,6 +536,92 @@ func (c *Config) process() {
 		levelString = os.Getenv("LOG_LEVEL")
 	}
 
+	if maxDepth, err := strconv.Atoi(os.Getenv("MAX_DEPTH")); err == nil {
+		c.maxDepth = maxDepth
+	}
+
+	if os.Getenv("FAKE") != "" {
+		c.fake = os.Getenv("FAKE") == "true"
+	}
+
+	// Zero is a seed like any other, so note if one was given at all
+	seedSet := false
+
+	flag.Visit(func(f *flag.Flag) {
+		seedSet = seedSet || f.Name == "seed"
+	})
+
+	if seed, err := strconv.ParseInt(os.Getenv("SEED"), 10, 64); err == nil {
+		c.seed = seed
+		seedSet = true
+	}
+
+	if os.Getenv("SEED_PATH") != "" {
+		c.seedPath = os.Getenv("SEED_PATH") == "true"
+	}
+
+	if os.Getenv("CHECK_RESPONSES") != "" {
+		c.checkResponses = os.Getenv("CHECK_RESPONSES")
+	}
+
+	if os.Getenv("VALIDATE") != "" {
+		c.validate = os.Getenv("VALIDATE") == "true"
+	}
+
+	if os.Getenv("STATEFUL") != "" {
+		c.stateful = os.Getenv("STATEFUL") == "true"
+	}
+
+	if os.Getenv("STORE_FILE") != "" {
+		c.storeFile = os.Getenv("STORE_FILE")
+	}
+
+	if os.Getenv("FIXTURES") != "" {
+		c.fixtures = os.Getenv("FIXTURES")
+	}
+
+	if os.Getenv("WATCH") != "" {
+		c.watch = os.Getenv("WATCH") == "true"
+	}
+
+	if journalSize, err := strconv.Atoi(os.Getenv("JOURNAL_SIZE")); err == nil {
+		c.journalSize = journalSize
+	}
+
+	if os.Getenv("PROXY_TARGET") != "" {
+		c.proxyTarget = os.Getenv("PROXY_TARGET")
+	}
+
+	if os.Getenv("RECORD") != "" {
+		c.record = os.Getenv("RECORD")
+	}
+
+	if os.Getenv("PLAYBACK") != "" {
+		c.playback = os.Getenv("PLAYBACK")
+	}
+
+	if os.Getenv("MOCK_TAGS") != "" {
+		c.mockTags = strings.Split(os.Getenv("MOCK_TAGS"), ",")
+	}
+
+	if os.Getenv("MOCK_OPS") != "" {
+		c.mockOps = strings.Split(os.Getenv("MOCK_OPS"), ",")
+	}
+
+	if os.Getenv("EXAMPLES") != "" {
+		c.examples = os.Getenv("EXAMPLES")
+	}
+
+	// Resources are only stored in stateful mode, so these turn it on
+	if c.storeFile != "" || c.fixtures != "" {
+		c.stateful = true
+	}
+
+	// Pick a seed if none was given, it's logged so a run can be repeated
+	if !seedSet {
+		c.seed = time.Now().UnixNano()
+	}
+
 	portEnv := os.Getenv("PORT")
 	if portEnv != "" {
 		if port, err := strconv.Atoi(portEnv); err == nil {
@@ -315,7 +630,7 @@ func (c *Config) process() {
 	}
 
 	// Print help if no args
-	if c.specFile == "" {
+	if len(c.specFiles) == 0 {
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
@@ -340,4 +655,18 @@ func (c *Config) process() {
 			Level: c.logLevel,
 		}))
 	}
+
+	switch c.examples {
+	case strategyFirst, strategyRandom, strategyRoundRobin:
+	default:
+		logger.Warn("Unknown example strategy, using first", slog.Any("examples", c.examples))
+		c.examples = strategyFirst
+	}
+
+	switch c.checkResponses {
+	case checkOff, checkWarn, checkFail:
+	default:
+		logger.Warn("Unknown check responses mode, using off", slog.Any("checkResponses", c.checkResponses))
+		c.checkResponses = checkOff
+	}
 }
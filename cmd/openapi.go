@@ -5,11 +5,18 @@ package main
 // Mockery - OpenAPI spec structures
 // ----------------------------------------------------------------------------
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 type OpenAPIv2 struct {
 	Swagger     string              `json:"swagger" yaml:"swagger"`
 	Info        Info                `json:"info" yaml:"info"`
 	Host        string              `json:"host" yaml:"host"`
 	BasePath    string              `json:"basePath" yaml:"basePath"`
+	Consumes    []string            `json:"consumes" yaml:"consumes"`
+	Produces    []string            `json:"produces" yaml:"produces"`
 	Paths       map[string]PathSpec `json:"paths" yaml:"paths"`
 	Definitions map[string]Schema   `json:"definitions" yaml:"definitions"`
 }
@@ -25,6 +32,9 @@ type PathSpec struct {
 	Put        Operation    `json:"put" yaml:"put"`
 	Delete     Operation    `json:"delete" yaml:"delete"`
 	Patch      Operation    `json:"patch" yaml:"patch"`
+	Head       Operation    `json:"head" yaml:"head"`
+	Options    Operation    `json:"options" yaml:"options"`
+	Trace      Operation    `json:"trace" yaml:"trace"`
 	Parameters []Parameters `json:"parameters" yaml:"parameters"`
 }
 
@@ -37,51 +47,405 @@ type Operation struct {
 	Produces    []string     `json:"produces" yaml:"produces"`
 	Parameters  []Parameters `json:"parameters" yaml:"parameters"`
 	Responses   Responses    `json:"responses" yaml:"responses"`
+
+	// Always mocked, even when proxying, for operations the upstream doesn't have yet
+	Mock bool `json:"x-mock" yaml:"x-mock"`
 }
 
 type Parameters struct {
-	Name        string `json:"name" yaml:"name"`
-	In          string `json:"in" yaml:"in"`
-	Description string `json:"description" yaml:"description"`
-	Required    bool   `json:"required" yaml:"required"`
-	Schema      Schema `json:"schema" yaml:"schema"`
+	Name         string `json:"name" yaml:"name"`
+	In           string `json:"in" yaml:"in"`
+	Description  string `json:"description" yaml:"description"`
+	Required     bool   `json:"required" yaml:"required"`
+	Schema       Schema `json:"schema" yaml:"schema"`
+	Example      any    `json:"x-example" yaml:"x-example"`
+	InlineSchema `json:",inline" yaml:",inline"`
+}
+
+// Get the schema of a parameter, v2 has the type inline for anything but a body
+func (p Parameters) schema() Schema {
+	if p.In == "body" || !p.Schema.isEmpty() {
+		return p.Schema
+	}
+
+	return p.InlineSchema.schema()
 }
 
 type Responses map[string]Response
 
 type Response struct {
-	Description string         `json:"description" yaml:"description"`
-	Schema      Schema         `json:"schema" yaml:"schema"`
-	Examples    map[string]any `json:"examples" yaml:"examples"`
-	StatusCode  int            `json:"-" yaml:"-"`
+	Description   string            `json:"description" yaml:"description"`
+	Schema        Schema            `json:"schema" yaml:"schema"`
+	Examples      map[string]any    `json:"examples" yaml:"examples"`
+	NamedExamples map[string]any    `json:"x-examples" yaml:"x-examples"`
+	Headers       map[string]Header `json:"headers" yaml:"headers"`
+	StatusCode    int               `json:"-" yaml:"-"`
+	Produces      []string          `json:"-" yaml:"-"`
+}
+
+// Header in a response, v2 has the type inline while v3 has a schema
+type Header struct {
+	Description  string  `json:"description" yaml:"description"`
+	Example      any     `json:"x-example" yaml:"x-example"`
+	Schema       *Schema `json:"-" yaml:"-"`
+	InlineSchema `json:",inline" yaml:",inline"`
+}
+
+// Get the schema of a header, building one from the inline v2 fields if needed
+func (h Header) schema() Schema {
+	if h.Schema != nil {
+		return *h.Schema
+	}
+
+	return h.InlineSchema.schema()
+}
+
+// InlineSchema is the subset of schema fields that v2 allows directly on
+// parameters (other than body) & headers
+type InlineSchema struct {
+	Type             SchemaType     `json:"type" yaml:"type"`
+	Format           string         `json:"format" yaml:"format"`
+	Items            *Schema        `json:"items" yaml:"items"`
+	CollectionFormat string         `json:"collectionFormat" yaml:"collectionFormat"`
+	Enum             []any          `json:"enum" yaml:"enum"`
+	Minimum          *float64       `json:"minimum" yaml:"minimum"`
+	Maximum          *float64       `json:"maximum" yaml:"maximum"`
+	ExclusiveMinimum ExclusiveBound `json:"exclusiveMinimum" yaml:"exclusiveMinimum"`
+	ExclusiveMaximum ExclusiveBound `json:"exclusiveMaximum" yaml:"exclusiveMaximum"`
+	MultipleOf       *float64       `json:"multipleOf" yaml:"multipleOf"`
+	MinLength        *int           `json:"minLength" yaml:"minLength"`
+	MaxLength        *int           `json:"maxLength" yaml:"maxLength"`
+	Pattern          string         `json:"pattern" yaml:"pattern"`
+	MinItems         *int           `json:"minItems" yaml:"minItems"`
+	MaxItems         *int           `json:"maxItems" yaml:"maxItems"`
+	Default          any            `json:"default" yaml:"default"`
+}
+
+func (i InlineSchema) schema() Schema {
+	return Schema{
+		Type:             i.Type,
+		Format:           i.Format,
+		Items:            i.Items,
+		Enum:             i.Enum,
+		Minimum:          i.Minimum,
+		Maximum:          i.Maximum,
+		ExclusiveMinimum: i.ExclusiveMinimum,
+		ExclusiveMaximum: i.ExclusiveMaximum,
+		MultipleOf:       i.MultipleOf,
+		MinLength:        i.MinLength,
+		MaxLength:        i.MaxLength,
+		Pattern:          i.Pattern,
+		MinItems:         i.MinItems,
+		MaxItems:         i.MaxItems,
+	}
 }
 
 type Schema struct {
 	Example              interface{}           `json:"example" yaml:"example"`
-	Type                 string                `json:"type" yaml:"type"`
-	Items                Items                 `json:"items" yaml:"items"`
-	Properties           map[string]Properties `json:"properties" yaml:"properties"`
+	Examples             []any                 `json:"examples" yaml:"examples"`
+	Const                any                   `json:"const" yaml:"const"`
+	Type                 SchemaType            `json:"type" yaml:"type"`
+	Nullable             bool                  `json:"nullable" yaml:"nullable"`
+	Items                *Schema               `json:"items" yaml:"items"`
+	PrefixItems          []Schema              `json:"prefixItems" yaml:"prefixItems"`
+	Properties           map[string]Schema     `json:"properties" yaml:"properties"`
+	Required             []string              `json:"required" yaml:"required"`
 	Ref                  string                `json:"$ref" yaml:"$ref"`
-	AdditionalProperties any                   `json:"additionalProperties" yaml:"additionalProperties"`
+	AdditionalProperties *AdditionalProperties `json:"additionalProperties" yaml:"additionalProperties"`
+	Defs                 map[string]Schema     `json:"$defs" yaml:"$defs"`
+	AllOf                []Schema              `json:"allOf" yaml:"allOf"`
+	OneOf                []Schema              `json:"oneOf" yaml:"oneOf"`
+	AnyOf                []Schema              `json:"anyOf" yaml:"anyOf"`
+	Not                  *Schema               `json:"not" yaml:"not"`
+	Discriminator        Discriminator         `json:"discriminator" yaml:"discriminator"`
+	Format               string                `json:"format" yaml:"format"`
+	Enum                 []any                 `json:"enum" yaml:"enum"`
+	Minimum              *float64              `json:"minimum" yaml:"minimum"`
+	Maximum              *float64              `json:"maximum" yaml:"maximum"`
+	ExclusiveMinimum     ExclusiveBound        `json:"exclusiveMinimum" yaml:"exclusiveMinimum"`
+	ExclusiveMaximum     ExclusiveBound        `json:"exclusiveMaximum" yaml:"exclusiveMaximum"`
+	MultipleOf           *float64              `json:"multipleOf" yaml:"multipleOf"`
+	MinLength            *int                  `json:"minLength" yaml:"minLength"`
+	MaxLength            *int                  `json:"maxLength" yaml:"maxLength"`
+	Pattern              string                `json:"pattern" yaml:"pattern"`
+	MinItems             *int                  `json:"minItems" yaml:"minItems"`
+	MaxItems             *int                  `json:"maxItems" yaml:"maxItems"`
+	UniqueItems          bool                  `json:"uniqueItems" yaml:"uniqueItems"`
+	XML                  XMLObject             `json:"xml" yaml:"xml"`
+}
+
+// How a schema is represented as XML, names default to the property or model name
+type XMLObject struct {
+	Name      string `json:"name" yaml:"name"`
+	Namespace string `json:"namespace" yaml:"namespace"`
+	Prefix    string `json:"prefix" yaml:"prefix"`
+	Attribute bool   `json:"attribute" yaml:"attribute"`
+	Wrapped   bool   `json:"wrapped" yaml:"wrapped"`
+}
+
+// Name of an element or attribute with the namespace prefix, if there is one
+func (x XMLObject) qualified(name string) string {
+	if x.Prefix != "" {
+		return x.Prefix + ":" + name
+	}
+
+	return name
+}
+
+// AdditionalProperties can be a boolean, or a schema for the values of extra properties
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *AdditionalProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		return nil
+	}
+
+	a.Allowed = true
+	a.Schema = &Schema{}
+
+	return json.Unmarshal(data, a.Schema)
+}
+
+func (a *AdditionalProperties) UnmarshalYAML(unmarshal func(any) error) error {
+	if err := unmarshal(&a.Allowed); err == nil {
+		return nil
+	}
+
+	a.Allowed = true
+	a.Schema = &Schema{}
+
+	return unmarshal(a.Schema)
+}
+
+func (a AdditionalProperties) MarshalJSON() ([]byte, error) {
+	if a.Schema != nil {
+		return json.Marshal(a.Schema)
+	}
+
+	return json.Marshal(a.Allowed)
+}
+
+// SchemaType holds the schema `type` which is a single string in OpenAPI v2 & v3.0
+// but can also be an array of types in OpenAPI v3.1, e.g. ["string", "null"]
+type SchemaType []string
+
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	return t.set(raw)
+}
+
+func (t *SchemaType) UnmarshalYAML(unmarshal func(any) error) error {
+	var raw any
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	return t.set(raw)
+}
+
+// Single types are written back out as a plain string, so v2 & v3.0 round trip
+func (t SchemaType) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+
+	return json.Marshal([]string(t))
 }
 
-type Items struct {
-	Type       string                `json:"type" yaml:"type"`
-	Properties map[string]Properties `json:"properties" yaml:"properties"`
-	Ref        string                `json:"$ref" yaml:"$ref"`
+func (t *SchemaType) set(raw any) error {
+	switch v := raw.(type) {
+	case nil:
+		*t = nil
+	case string:
+		*t = SchemaType{v}
+	case []any:
+		types := make(SchemaType, 0, len(v))
+		for _, item := range v {
+			typeName, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("schema type must be a string, got: %v", item)
+			}
+			types = append(types, typeName)
+		}
+		*t = types
+	default:
+		return fmt.Errorf("schema type must be a string or array, got: %v", raw)
+	}
+
+	return nil
+}
+
+// Check if the type is, or includes, the given type name
+func (t SchemaType) is(typeName string) bool {
+	for _, name := range t {
+		if name == typeName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// The main type used to generate values, i.e. the first type that isn't null
+func (t SchemaType) primary() string {
+	for _, name := range t {
+		if name != "null" {
+			return name
+		}
+	}
+
+	if len(t) > 0 {
+		return "null"
+	}
+
+	return ""
+}
+
+// ExclusiveBound is a boolean modifier of minimum/maximum in OpenAPI v2 & v3.0
+// but is a number and the bound itself in OpenAPI v3.1
+type ExclusiveBound struct {
+	Enabled bool
+	Value   *float64
+}
+
+func (e *ExclusiveBound) UnmarshalJSON(data []byte) error {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	return e.set(raw)
+}
+
+func (e *ExclusiveBound) UnmarshalYAML(unmarshal func(any) error) error {
+	var raw any
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	return e.set(raw)
+}
+
+func (e ExclusiveBound) MarshalJSON() ([]byte, error) {
+	if e.Value != nil {
+		return json.Marshal(e.Value)
+	}
+
+	return json.Marshal(e.Enabled)
+}
+
+func (e *ExclusiveBound) set(raw any) error {
+	switch v := raw.(type) {
+	case nil:
+		return nil
+	case bool:
+		e.Enabled = v
+		return nil
+	}
+
+	num, ok := toFloat(raw)
+	if !ok {
+		return fmt.Errorf("exclusive bound must be a boolean or number, got: %v", raw)
+	}
+
+	e.Enabled = true
+	e.Value = &num
+
+	return nil
 }
 
-type Properties struct {
-	Type       string                `json:"type" yaml:"type"`
-	Example    interface{}           `json:"example" yaml:"example"`
-	Properties map[string]Properties `json:"properties" yaml:"properties"`
+// Discriminator is just the property name in OpenAPI v2, but an object in v3
+type Discriminator struct {
+	PropertyName string            `json:"propertyName" yaml:"propertyName"`
+	Mapping      map[string]string `json:"mapping" yaml:"mapping"`
+}
+
+func (d *Discriminator) UnmarshalJSON(data []byte) error {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	return d.set(raw)
+}
+
+func (d *Discriminator) UnmarshalYAML(unmarshal func(any) error) error {
+	var raw any
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	return d.set(raw)
+}
+
+func (d *Discriminator) set(raw any) error {
+	switch v := raw.(type) {
+	case nil:
+		return nil
+	case string:
+		d.PropertyName = v
+		return nil
+	case map[string]any:
+		d.PropertyName, _ = v["propertyName"].(string)
+		if mapping, ok := v["mapping"].(map[string]any); ok {
+			d.Mapping = make(map[string]string)
+			for key, ref := range mapping {
+				d.Mapping[key], _ = ref.(string)
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("discriminator must be a string or object, got: %v", raw)
+}
+
+// The value of the discriminator property for a model, from the mapping if there's
+// an entry pointing at the model, otherwise the model name is the value
+func (d Discriminator) valueFor(modelName string) string {
+	for _, value := range sortedKeys(d.Mapping) {
+		if refName(d.Mapping[value]) == modelName {
+			return value
+		}
+	}
+
+	return modelName
 }
 
 func (s Schema) isEmpty() bool {
-	return s.Type == "" && s.Ref == "" && s.Properties == nil &&
-		s.Items.isEmpty() && s.AdditionalProperties == nil && s.Example == nil
+	return len(s.Type) == 0 && s.Ref == "" && s.Properties == nil && s.PrefixItems == nil &&
+		s.Items == nil && s.AdditionalProperties == nil && s.Example == nil &&
+		s.Examples == nil && s.Const == nil && s.AllOf == nil && s.OneOf == nil && s.AnyOf == nil &&
+		s.Enum == nil && s.Format == "" && !s.hasConstraints()
+}
+
+// Constraints can be given without a type, they still make a schema & hint at its type
+func (s Schema) hasConstraints() bool {
+	return s.Minimum != nil || s.Maximum != nil || s.ExclusiveMinimum.Enabled || s.ExclusiveMinimum.Value != nil ||
+		s.ExclusiveMaximum.Enabled || s.ExclusiveMaximum.Value != nil || s.MultipleOf != nil ||
+		s.MinLength != nil || s.MaxLength != nil || s.Pattern != "" || s.MinItems != nil || s.MaxItems != nil
 }
 
-func (i Items) isEmpty() bool {
-	return i.Type == "" && i.Ref == "" && i.Properties == nil
+// Lower bound of a numeric schema, taking into account both styles of exclusive bound
+func (s Schema) lowerBound() (*float64, bool) {
+	if s.ExclusiveMinimum.Value != nil {
+		return s.ExclusiveMinimum.Value, true
+	}
+
+	return s.Minimum, s.ExclusiveMinimum.Enabled
+}
+
+// Upper bound of a numeric schema, taking into account both styles of exclusive bound
+func (s Schema) upperBound() (*float64, bool) {
+	if s.ExclusiveMaximum.Value != nil {
+		return s.ExclusiveMaximum.Value, true
+	}
+
+	return s.Maximum, s.ExclusiveMaximum.Enabled
 }
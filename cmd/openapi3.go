@@ -0,0 +1,399 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - OpenAPI v3 spec structures & conversion to the internal model
+// ----------------------------------------------------------------------------
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+type OpenAPIv3 struct {
+	OpenAPI           string                `json:"openapi" yaml:"openapi"`
+	Info              Info                  `json:"info" yaml:"info"`
+	JSONSchemaDialect string                `json:"jsonSchemaDialect" yaml:"jsonSchemaDialect"`
+	Servers           []Server              `json:"servers" yaml:"servers"`
+	Paths             map[string]PathItemV3 `json:"paths" yaml:"paths"`
+	Webhooks          map[string]PathItemV3 `json:"webhooks" yaml:"webhooks"`
+	Components        Components            `json:"components" yaml:"components"`
+}
+
+type Server struct {
+	URL         string                    `json:"url" yaml:"url"`
+	Description string                    `json:"description" yaml:"description"`
+	Variables   map[string]ServerVariable `json:"variables" yaml:"variables"`
+}
+
+type ServerVariable struct {
+	Default     string   `json:"default" yaml:"default"`
+	Enum        []string `json:"enum" yaml:"enum"`
+	Description string   `json:"description" yaml:"description"`
+}
+
+type Components struct {
+	Schemas       map[string]Schema        `json:"schemas" yaml:"schemas"`
+	Responses     map[string]ResponseV3    `json:"responses" yaml:"responses"`
+	Parameters    map[string]ParameterV3   `json:"parameters" yaml:"parameters"`
+	RequestBodies map[string]RequestBody   `json:"requestBodies" yaml:"requestBodies"`
+	Examples      map[string]ExampleObject `json:"examples" yaml:"examples"`
+	Headers       map[string]HeaderV3      `json:"headers" yaml:"headers"`
+}
+
+type PathItemV3 struct {
+	Summary     string        `json:"summary" yaml:"summary"`
+	Description string        `json:"description" yaml:"description"`
+	Get         OperationV3   `json:"get" yaml:"get"`
+	Put         OperationV3   `json:"put" yaml:"put"`
+	Post        OperationV3   `json:"post" yaml:"post"`
+	Delete      OperationV3   `json:"delete" yaml:"delete"`
+	Options     OperationV3   `json:"options" yaml:"options"`
+	Head        OperationV3   `json:"head" yaml:"head"`
+	Patch       OperationV3   `json:"patch" yaml:"patch"`
+	Trace       OperationV3   `json:"trace" yaml:"trace"`
+	Parameters  []ParameterV3 `json:"parameters" yaml:"parameters"`
+}
+
+type OperationV3 struct {
+	Tags        []string              `json:"tags" yaml:"tags"`
+	Summary     string                `json:"summary" yaml:"summary"`
+	Description string                `json:"description" yaml:"description"`
+	OperationID string                `json:"operationId" yaml:"operationId"`
+	Parameters  []ParameterV3         `json:"parameters" yaml:"parameters"`
+	RequestBody RequestBody           `json:"requestBody" yaml:"requestBody"`
+	Responses   map[string]ResponseV3 `json:"responses" yaml:"responses"`
+	Mock        bool                  `json:"x-mock" yaml:"x-mock"`
+}
+
+type ParameterV3 struct {
+	Ref         string                   `json:"$ref" yaml:"$ref"`
+	Name        string                   `json:"name" yaml:"name"`
+	In          string                   `json:"in" yaml:"in"`
+	Description string                   `json:"description" yaml:"description"`
+	Required    bool                     `json:"required" yaml:"required"`
+	Schema      Schema                   `json:"schema" yaml:"schema"`
+	Example     any                      `json:"example" yaml:"example"`
+	Examples    map[string]ExampleObject `json:"examples" yaml:"examples"`
+}
+
+type RequestBody struct {
+	Ref         string               `json:"$ref" yaml:"$ref"`
+	Description string               `json:"description" yaml:"description"`
+	Required    bool                 `json:"required" yaml:"required"`
+	Content     map[string]MediaType `json:"content" yaml:"content"`
+}
+
+type ResponseV3 struct {
+	Ref         string               `json:"$ref" yaml:"$ref"`
+	Description string               `json:"description" yaml:"description"`
+	Headers     map[string]HeaderV3  `json:"headers" yaml:"headers"`
+	Content     map[string]MediaType `json:"content" yaml:"content"`
+}
+
+type HeaderV3 struct {
+	Ref         string                   `json:"$ref" yaml:"$ref"`
+	Description string                   `json:"description" yaml:"description"`
+	Required    bool                     `json:"required" yaml:"required"`
+	Schema      Schema                   `json:"schema" yaml:"schema"`
+	Example     any                      `json:"example" yaml:"example"`
+	Examples    map[string]ExampleObject `json:"examples" yaml:"examples"`
+}
+
+type MediaType struct {
+	Schema   Schema                   `json:"schema" yaml:"schema"`
+	Example  any                      `json:"example" yaml:"example"`
+	Examples map[string]ExampleObject `json:"examples" yaml:"examples"`
+}
+
+type ExampleObject struct {
+	Ref           string `json:"$ref" yaml:"$ref"`
+	Summary       string `json:"summary" yaml:"summary"`
+	Description   string `json:"description" yaml:"description"`
+	Value         any    `json:"value" yaml:"value"`
+	ExternalValue string `json:"externalValue" yaml:"externalValue"`
+}
+
+// Convert a v3 spec into the internal model, which is based on the v2 structures
+// Anything that v2 can't express (multiple servers, links, callbacks etc) is dropped
+func (s OpenAPIv3) toV2() OpenAPIv2 {
+	v2 := OpenAPIv2{
+		Swagger:     "2.0",
+		Info:        s.Info,
+		BasePath:    s.basePath(),
+		Paths:       make(map[string]PathSpec),
+		Definitions: make(map[string]Schema),
+	}
+
+	for name, schema := range s.Components.Schemas {
+		v2.Definitions[name] = schema
+	}
+
+	for path, item := range s.Paths {
+		params := s.convertParams(item.Parameters)
+
+		v2.Paths[path] = PathSpec{
+			Get:        s.convertOperation(item.Get),
+			Post:       s.convertOperation(item.Post),
+			Put:        s.convertOperation(item.Put),
+			Delete:     s.convertOperation(item.Delete),
+			Patch:      s.convertOperation(item.Patch),
+			Head:       s.convertOperation(item.Head),
+			Options:    s.convertOperation(item.Options),
+			Trace:      s.convertOperation(item.Trace),
+			Parameters: params,
+		}
+	}
+
+	return v2
+}
+
+// Work out the base path from the first server URL, substituting any variables
+func (s OpenAPIv3) basePath() string {
+	if len(s.Servers) == 0 {
+		return "/"
+	}
+
+	server := s.Servers[0]
+	serverURL := server.URL
+	for name, variable := range server.Variables {
+		serverURL = strings.ReplaceAll(serverURL, "{"+name+"}", variable.Default)
+	}
+
+	u, err := url.Parse(serverURL)
+	if err != nil || u.Path == "" {
+		return "/"
+	}
+
+	return u.Path
+}
+
+func (s OpenAPIv3) convertOperation(op OperationV3) Operation {
+	v2op := Operation{
+		Tags:        op.Tags,
+		Summary:     op.Summary,
+		Description: op.Description,
+		OperationID: op.OperationID,
+		Parameters:  s.convertParams(op.Parameters),
+		Mock:        op.Mock,
+	}
+
+	// Leave responses nil when there are none, that's how we detect missing operations
+	if op.Responses != nil {
+		v2op.Responses = make(Responses)
+	}
+
+	// Request body becomes a v2 style body parameter
+	body := s.resolveRequestBody(op.RequestBody)
+	if len(body.Content) > 0 {
+		_, media := pickMediaType(body.Content)
+		v2op.Consumes = sortedKeys(body.Content)
+		v2op.Parameters = append(v2op.Parameters, Parameters{
+			Name:        "body",
+			In:          "body",
+			Description: body.Description,
+			Required:    body.Required,
+			Schema:      media.Schema,
+		})
+	}
+
+	produces := map[string]bool{}
+	for status, resp := range op.Responses {
+		resp = s.resolveResponse(resp)
+		v2resp := Response{
+			Description: resp.Description,
+			Headers:     s.convertHeaders(resp.Headers),
+		}
+
+		if len(resp.Content) > 0 {
+			preferred, media := pickMediaType(resp.Content)
+			v2resp.Schema = media.Schema
+			v2resp.NamedExamples = s.namedExamples(media)
+
+			// Preferred media type first, it's used when the caller will accept anything
+			v2resp.Produces = []string{preferred}
+			for _, mediaType := range sortedKeys(resp.Content) {
+				if mediaType != preferred {
+					v2resp.Produces = append(v2resp.Produces, mediaType)
+				}
+			}
+
+			for mediaType, m := range resp.Content {
+				produces[mediaType] = true
+
+				if ex := s.mediaExample(m); ex != nil {
+					if v2resp.Examples == nil {
+						v2resp.Examples = make(map[string]any)
+					}
+					v2resp.Examples[mediaType] = ex
+				}
+			}
+		}
+
+		v2op.Responses[status] = v2resp
+	}
+
+	v2op.Produces = sortedKeys(produces)
+
+	return v2op
+}
+
+func (s OpenAPIv3) convertHeaders(headers map[string]HeaderV3) map[string]Header {
+	if len(headers) == 0 {
+		return nil
+	}
+
+	out := make(map[string]Header)
+
+	for name, h := range headers {
+		h = s.resolveHeader(h)
+		schema := h.Schema
+
+		header := Header{
+			Description: h.Description,
+			Schema:      &schema,
+			Example:     h.Example,
+		}
+
+		if header.Example == nil {
+			header.Example = s.mediaExample(MediaType{Examples: h.Examples})
+		}
+
+		out[name] = header
+	}
+
+	return out
+}
+
+func (s OpenAPIv3) convertParams(params []ParameterV3) []Parameters {
+	out := make([]Parameters, 0, len(params))
+
+	for _, p := range params {
+		p = s.resolveParameter(p)
+		out = append(out, Parameters{
+			Name:        p.Name,
+			In:          p.In,
+			Description: p.Description,
+			Required:    p.Required,
+			Schema:      p.Schema,
+			Example:     s.mediaExample(MediaType{Example: p.Example, Examples: p.Examples}),
+		})
+	}
+
+	return out
+}
+
+// Get a single example from a media type, the singular example wins over named ones
+func (s OpenAPIv3) mediaExample(m MediaType) any {
+	if m.Example != nil {
+		return m.Example
+	}
+
+	for _, name := range sortedKeys(m.Examples) {
+		ex := s.resolveExample(m.Examples[name])
+		if ex.Value != nil {
+			return ex.Value
+		}
+	}
+
+	return nil
+}
+
+// All the named examples of a media type, resolving any refs
+func (s OpenAPIv3) namedExamples(m MediaType) map[string]any {
+	if len(m.Examples) == 0 {
+		return nil
+	}
+
+	named := make(map[string]any)
+	for name, ex := range m.Examples {
+		if ex = s.resolveExample(ex); ex.Value != nil {
+			named[name] = ex.Value
+		}
+	}
+
+	return named
+}
+
+// Resolving refs to components, these follow the same approach as schema refs
+// i.e. the last part of the ref is the name of the component
+
+func (s OpenAPIv3) resolveResponse(r ResponseV3) ResponseV3 {
+	if r.Ref == "" {
+		return r
+	}
+
+	return s.Components.Responses[refName(r.Ref)]
+}
+
+func (s OpenAPIv3) resolveParameter(p ParameterV3) ParameterV3 {
+	if p.Ref == "" {
+		return p
+	}
+
+	return s.Components.Parameters[refName(p.Ref)]
+}
+
+func (s OpenAPIv3) resolveRequestBody(b RequestBody) RequestBody {
+	if b.Ref == "" {
+		return b
+	}
+
+	return s.Components.RequestBodies[refName(b.Ref)]
+}
+
+func (s OpenAPIv3) resolveHeader(h HeaderV3) HeaderV3 {
+	if h.Ref == "" {
+		return h
+	}
+
+	return s.Components.Headers[refName(h.Ref)]
+}
+
+func (s OpenAPIv3) resolveExample(e ExampleObject) ExampleObject {
+	if e.Ref == "" {
+		return e
+	}
+
+	return s.Components.Examples[refName(e.Ref)]
+}
+
+// Pick the best media type from a content map, JSON is preferred
+func pickMediaType(content map[string]MediaType) (string, MediaType) {
+	if m, ok := content[contentType]; ok {
+		return contentType, m
+	}
+
+	keys := sortedKeys(content)
+	for _, k := range keys {
+		if strings.Contains(k, "json") {
+			return k, content[k]
+		}
+	}
+
+	if len(keys) > 0 {
+		return keys[0], content[keys[0]]
+	}
+
+	return "", MediaType{}
+}
+
+// Map keys in a stable order, Go maps are random and we want predictable output
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// Last part of a ref string is the name of the thing referenced
+func refName(ref string) string {
+	refParts := strings.Split(ref, "/")
+
+	return refParts[len(refParts)-1]
+}
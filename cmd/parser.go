@@ -7,180 +7,606 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"log/slog"
+	"math/rand"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/goccy/go-yaml"
 )
 
+// ParseSpec parses an OpenAPI spec file of any supported version, detecting the
+// version from the `swagger` or `openapi` field. v3 specs are converted to the
+// internal model so the rest of mockery can treat them the same as v2
+func ParseSpec(filePath string) (OpenAPIv2, error) {
+	var version struct {
+		Swagger string `json:"swagger" yaml:"swagger"`
+		OpenAPI string `json:"openapi" yaml:"openapi"`
+	}
+
+	if err := loadSpecFile(filePath, &version); err != nil {
+		return OpenAPIv2{}, err
+	}
+
+	switch {
+	case version.Swagger == "2.0":
+		return ParseV2Spec(filePath)
+
+	case strings.HasPrefix(version.OpenAPI, "3.0"), strings.HasPrefix(version.OpenAPI, "3.1"):
+		specV3, err := ParseV3Spec(filePath)
+		if err != nil {
+			return OpenAPIv2{}, err
+		}
+
+		if len(specV3.Webhooks) > 0 {
+			logger.Info("Spec defines webhooks, these are outbound so will not be mocked",
+				slog.Any("count", len(specV3.Webhooks)))
+		}
+
+		return specV3.toV2(), nil
+
+	case version.OpenAPI != "":
+		return OpenAPIv2{}, fmt.Errorf("unsupported OpenAPI version: %s", version.OpenAPI)
+
+	case version.Swagger != "":
+		return OpenAPIv2{}, fmt.Errorf("unsupported Swagger version: %s", version.Swagger)
+	}
+
+	return OpenAPIv2{}, fmt.Errorf("unable to detect spec version, no 'swagger' or 'openapi' field")
+}
+
 // ParseV2Spec parses an OpenAPI v2 spec file
 func ParseV2Spec(filePath string) (OpenAPIv2, error) {
+	var openAPIv2 OpenAPIv2
+	err := loadResolvedSpec(filePath, &openAPIv2)
+
+	return openAPIv2, err
+}
+
+// ParseV3Spec parses an OpenAPI v3 spec file
+func ParseV3Spec(filePath string) (OpenAPIv3, error) {
+	var openAPIv3 OpenAPIv3
+	err := loadResolvedSpec(filePath, &openAPIv3)
+
+	return openAPIv3, err
+}
+
+// Read a spec file and unmarshal it as JSON or YAML based on the file extension
+func loadSpecFile(filePath string, out any) error {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return OpenAPIv2{}, err
+		return err
 	}
 
 	defer file.Close()
 
 	data, err := io.ReadAll(file)
 	if err != nil {
-		return OpenAPIv2{}, err
+		return err
 	}
 
-	var openAPIv2 OpenAPIv2
-
 	// Handle YAML format as well
-	if strings.HasSuffix(filePath, ".yaml") || strings.HasSuffix(filePath, ".yml") {
-		err = yaml.Unmarshal(data, &openAPIv2)
-		return openAPIv2, err
+	if isYAMLFile(filePath) {
+		return yaml.Unmarshal(data, out)
 	}
 
-	err = json.Unmarshal(data, &openAPIv2)
-	return openAPIv2, err
+	return json.Unmarshal(data, out)
+}
+
+// Generator holds the state needed while walking schemas to build a payload
+type generator struct {
+	definitions map[string]Schema
+
+	// Which oneOf/anyOf branch to pick, either an index or a model/mapping name
+	variant string
+
+	// Names of the models currently being expanded, innermost is last
+	models []string
+
+	// How deep we are in nested objects & arrays, and how deep we're allowed to go
+	depth    int
+	maxDepth int
+
+	// Fake data mode, the name of the property being generated is used to pick values
+	fake bool
+	name string
+
+	// Seeded so the same request always gets the same payload
+	rand *rand.Rand
+
+	// Name of the example requested by the caller, how to pick one when there isn't
+	// a name, and how many times the response has been requested for round-robin
+	example         string
+	exampleStrategy string
+	sequence        int
+
+	// Media type of the response, as examples are per media type
+	mediaType string
+}
+
+func newGenerator(definitions map[string]Schema) *generator {
+	return &generator{
+		definitions: definitions,
+		maxDepth:    config.maxDepth,
+		fake:        config.fake,
+		rand:        rand.New(rand.NewSource(config.seed)), //nolint:gosec // Fake data, not security
+
+		exampleStrategy: config.examples,
+		mediaType:       contentType,
+	}
 }
 
 // Parsing a schema is a bit of a nightmare, this is the entry point
-func (s Schema) parse() interface{} {
+func (s Schema) parse(definitions map[string]Schema) interface{} {
+	return newGenerator(definitions).schema(s)
+}
+
+// The heart of the generator, every schema whether it's a model, property or array item
+// comes through here, so refs, composition, objects & arrays can be nested in any way
+func (g *generator) schema(s Schema) interface{} {
 	logger.Debug("Parsing schema", slog.Any("schema", s))
 
 	if s.isEmpty() {
 		return nil
 	}
 
-	// Simple case: Schema has example object
+	// A const has only one possible value, so it's the best example there is
+	if s.Const != nil {
+		return s.Const
+	}
+
+	// Simple case: Schema has example object, or an array of examples in v3.1
 	if s.Example != nil {
 		return s.Example
 	}
 
-	var ref string
+	if len(s.Examples) > 0 {
+		return s.Examples[0]
+	}
+
+	// Enums are the next best thing to an example
+	if len(s.Enum) > 0 {
+		if g.fake {
+			return s.Enum[g.rand.Intn(len(s.Enum))]
+		}
+
+		return s.Enum[0]
+	}
+
+	// A type of only null can't have any other value
+	if s.Type.primary() == "null" {
+		return nil
+	}
+
 	if s.isRef() {
-		ref = s.Ref
+		return g.ref(s.Ref)
 	}
 
-	// Special case for array of references
-	if s.Items.Ref != "" && s.Type == "array" {
-		ref = s.Items.Ref
+	// Composition keywords, these wrap everything else
+	if len(s.AllOf) > 0 {
+		return g.allOf(s)
 	}
 
-	// Another special case for array or object with items + properties
-	if s.Items.Properties != nil && (s.Type == "array" || s.Items.Type == "object") {
-		if s.Type == "array" {
-			return []interface{}{parseProperties(s.Items.Properties)}
-		}
-		return parseProperties(s.Items.Properties)
+	if len(s.OneOf) > 0 {
+		return g.oneOf(s, s.OneOf)
 	}
 
-	// Resolve references, this is a bit of a hack but seems ok
-	if ref != "" {
-		// Split ref string into parts
-		refParts := strings.Split(ref, "/")
-		// last part is the model name
-		modelName := refParts[len(refParts)-1]
+	if len(s.AnyOf) > 0 {
+		return g.oneOf(s, s.AnyOf)
+	}
 
-		// Get model definition
-		referencedSchema, defExists := spec.Definitions[modelName]
-		if !defExists {
+	// Type is often left out, so also look for the tell tale signs of arrays & objects
+	switch {
+	case s.Type.primary() == "array" || s.Items != nil || s.PrefixItems != nil || s.MinItems != nil || s.MaxItems != nil:
+		return g.array(s)
+	case s.Type.primary() == "object" || s.Properties != nil || s.AdditionalProperties != nil:
+		return g.object(s)
+	}
+
+	return g.scalar(s)
+}
+
+// Resolve a reference to a model and parse it
+func (g *generator) ref(ref string) interface{} {
+	// Last part of the ref is the model name
+	modelName := refName(ref)
+
+	// Get model definition
+	referencedSchema, defExists := g.definitions[modelName]
+	if !defExists {
+		logger.Warn("Referenced model not found", slog.Any("ref", ref))
+		return nil
+	}
+
+	// Self referencing models (e.g. tree nodes) would recurse forever, so stop here
+	for _, name := range g.models {
+		if name == modelName {
+			logger.Debug("Cycle detected, not expanding model again", slog.Any("name", modelName))
 			return nil
 		}
+	}
+
+	// Parse definition
+	logger.Info("Parsing model", slog.Any("name", modelName))
+
+	g.models = append(g.models, modelName)
+	defer func() { g.models = g.models[:len(g.models)-1] }()
+
+	return g.schema(referencedSchema)
+}
+
+// Build an object from the properties of a schema, recursing into each one
+func (g *generator) object(s Schema) interface{} {
+	if !g.enter() {
+		return nil
+	}
+	defer g.leave()
+
+	payload := make(map[string]interface{})
 
-		// Parse definition
-		logger.Info("Parsing model", slog.Any("name", modelName))
-		parsedSchema := referencedSchema.parse()
+	parentName := g.name
+	defer func() { g.name = parentName }()
+
+	for _, name := range sortedKeys(s.Properties) {
+		g.name = name
+		payload[name] = g.schema(s.Properties[name])
+	}
+
+	// Only make up extra properties if there are no real ones
+	if len(s.Properties) > 0 || s.AdditionalProperties == nil || !s.AdditionalProperties.Allowed {
+		return payload
+	}
+
+	// additionalProperties of true means anything goes
+	if s.AdditionalProperties.Schema == nil || s.AdditionalProperties.Schema.isEmpty() {
+		payload["key"] = "value"
+		return payload
+	}
+
+	payload["key1"] = g.schema(*s.AdditionalProperties.Schema)
+	payload["key2"] = g.schema(*s.AdditionalProperties.Schema)
+
+	return payload
+}
+
+// Build an array with a single item, or as many as minItems/maxItems require, or a
+// tuple in JSON Schema 2020-12 where each position has its own schema
+func (g *generator) array(s Schema) interface{} {
+	if !g.enter() {
+		return []interface{}{}
+	}
+	defer g.leave()
+
+	items := make([]interface{}, 0, 1)
+
+	for _, prefixItem := range s.PrefixItems {
+		items = append(items, g.schema(prefixItem))
+	}
 
-		// If it's an array, return an array of the parsed schema
-		if s.Type == "array" {
-			return []interface{}{parsedSchema}
+	if s.Items == nil || len(s.PrefixItems) > 0 {
+		return items
+	}
+
+	count := 1
+	if s.MinItems != nil && *s.MinItems > count {
+		count = *s.MinItems
+	}
+
+	// A few more items makes fake data look more realistic
+	if g.fake {
+		count += g.rand.Intn(4)
+	}
+
+	if s.MaxItems != nil && *s.MaxItems < count {
+		count = *s.MaxItems
+	}
+
+	for i := 0; i < count; i++ {
+		// Items cut short by a cycle or max depth are left out, rather than a null
+		if item := g.schema(*s.Items); item != nil {
+			items = append(items, item)
 		}
+	}
+
+	return items
+}
 
-		return parsedSchema
+// Track going down a level into an object or array, returns false when too deep
+func (g *generator) enter() bool {
+	if g.depth >= g.maxDepth {
+		logger.Debug("Max depth reached, payload will be truncated", slog.Any("depth", g.depth))
+		return false
 	}
 
-	// Special case for additionalProperties weirdness
-	if s.AdditionalProperties != nil {
-		_, isBool := s.AdditionalProperties.(bool)
-		if isBool {
-			return map[string]interface{}{
-				"key": "value",
-			}
+	g.depth++
+
+	return true
+}
+
+func (g *generator) leave() {
+	g.depth--
+}
+
+// Merge all the subschemas of allOf into a single object, later schemas win
+// When a subschema is a base model with a discriminator, it's set to the current model
+func (g *generator) allOf(s Schema) interface{} {
+	merged := make(map[string]interface{})
+	var last interface{}
+
+	// Any properties alongside allOf are merged in too
+	own := s
+	own.AllOf = nil
+	subSchemas := append(append([]Schema{}, s.AllOf...), own)
+
+	for _, sub := range subSchemas {
+		val := g.schema(sub)
+		if val == nil {
+			continue
 		}
 
-		if s.AdditionalProperties.(map[string]interface{})["type"] == "string" {
-			return map[string]interface{}{
-				"key 1": "value 1",
-				"key 2": "value 2",
-			}
+		last = val
+
+		valMap, isMap := val.(map[string]interface{})
+		if !isMap {
+			continue
 		}
-		if s.AdditionalProperties.(map[string]interface{})["type"] == "integer" {
-			return map[string]interface{}{
-				"key 1": 0,
-				"key 2": 1,
+
+		for k, v := range valMap {
+			merged[k] = v
+		}
+
+		if sub.isRef() && len(g.models) > 0 {
+			base := g.definitions[refName(sub.Ref)]
+			if base.Discriminator.PropertyName != "" {
+				merged[base.Discriminator.PropertyName] = base.Discriminator.valueFor(g.models[len(g.models)-1])
 			}
 		}
 	}
 
-	// Schema might just be a bag of properties, the OAS spec is a nightmare
+	// Not objects, e.g. allOf used to add constraints to a string
+	if len(merged) == 0 {
+		return last
+	}
+
+	return merged
+}
+
+// Pick one of the branches of a oneOf or anyOf, and set the discriminator if there is one
+func (g *generator) oneOf(s Schema, branches []Schema) interface{} {
+	index := g.pickBranch(s, branches)
+	branch := branches[index]
+	val := g.schema(branch)
+
+	valMap, isMap := val.(map[string]interface{})
+	if !isMap {
+		return val
+	}
+
+	// Any properties alongside oneOf are merged in too
 	if s.Properties != nil {
-		return parseProperties(s.Properties)
+		own := Schema{Properties: s.Properties}
+		if ownMap, ok := g.schema(own).(map[string]interface{}); ok {
+			for k, v := range ownMap {
+				if _, exists := valMap[k]; !exists {
+					valMap[k] = v
+				}
+			}
+		}
+	}
+
+	if s.Discriminator.PropertyName != "" && branch.isRef() {
+		valMap[s.Discriminator.PropertyName] = s.Discriminator.valueFor(refName(branch.Ref))
+	}
+
+	return valMap
+}
+
+// Which branch to use, the variant can be an index, a model name or a discriminator
+// mapping value, otherwise we default to the first branch
+func (g *generator) pickBranch(s Schema, branches []Schema) int {
+	if g.variant == "" {
+		return 0
+	}
+
+	if index, err := strconv.Atoi(g.variant); err == nil && index >= 0 && index < len(branches) {
+		return index
+	}
+
+	variantRef := s.Discriminator.Mapping[g.variant]
+	for i, branch := range branches {
+		if !branch.isRef() {
+			continue
+		}
+
+		if refName(branch.Ref) == g.variant || (variantRef != "" && refName(variantRef) == refName(branch.Ref)) {
+			return i
+		}
 	}
 
-	// If we get here, we don't know what to do
-	return nil
+	logger.Warn("Requested variant not found, using first", slog.Any("variant", g.variant))
+
+	return 0
 }
 
 // Parse a response object this is the start of the parsing process from the handler
-func (resp Response) parse() interface{} {
+func (resp Response) parse(definitions map[string]Schema) interface{} {
+	return resp.parseWith(newGenerator(definitions))
+}
+
+func (resp Response) parseWith(g *generator) interface{} {
 	logger.Debug("Building payload for", slog.Any("status", resp.StatusCode), slog.Any("description", resp.Description))
 
-	// Simple case 1: Response has examples defined per content type
+	// Simple case 1: Response has named examples, the caller or strategy picks one
+	// These are always JSON, either x-examples in v2 or from the JSON content in v3
+	if len(resp.NamedExamples) > 0 && isJSON(g.mediaType) {
+		return resp.pickExample(g)
+	}
+
+	// Simple case 2: Response has examples defined per content type
 	if resp.Examples != nil {
-		// We look for an example matching the content type of application/json
-		ex := resp.Examples[contentType]
+		// We look for an example matching the content type being returned
+		ex := resp.Examples[g.mediaType]
 		if ex != nil {
 			return ex
 		} else {
-			logger.Warn("No response example found for content type", slog.Any("content_type", contentType))
+			logger.Warn("No response example found for content type", slog.Any("content_type", g.mediaType))
 		}
 	}
 
 	// Complex case: We need to go down the rabbit hole of the schema
-	return resp.Schema.parse()
+	return g.schema(resp.Schema)
 }
 
-// The lowest level of the parser - parses a map of properties looking for examples
-// If no example is found, it will create one based on the type
-func parseProperties(properties map[string]Properties) interface{} {
-	payload := make(map[string]interface{})
+// Values for all the headers of a response, from examples or generated from the schema
+// Location is a special case, as clients will follow it, so it's made from the request
+// path and the id in the payload, e.g. POST /pets returns Location: /pets/123
+func (resp Response) headerValues(g *generator, path string, payload any) map[string]string {
+	values := make(map[string]string)
 
-	for key, prop := range properties {
-		var exampleVal any
-		if prop.Example == nil {
-			switch prop.Type {
-			case "string":
-				exampleVal = "string"
-			case "integer":
-				exampleVal = 0
-			case "boolean":
-				exampleVal = false
-			case "array":
-				exampleVal = []string{}
-			case "object":
-				// Recurse down the rabbit hole of sub-properties
-				if prop.Properties != nil {
-					exampleVal = parseProperties(prop.Properties)
-				} else {
-					exampleVal = make(map[string]interface{})
-				}
+	for _, name := range sortedKeys(resp.Headers) {
+		// Content-Type is ignored in headers as per the spec, it comes from negotiation
+		if strings.EqualFold(name, "Content-Type") {
+			continue
+		}
+
+		header := resp.Headers[name]
+		val := header.Example
+		if val == nil {
+			val = header.Default
+		}
+
+		if val == nil && strings.EqualFold(name, "Location") {
+			if obj, isObj := payload.(map[string]any); isObj && obj["id"] != nil {
+				val = strings.TrimSuffix(path, "/") + "/" + fmt.Sprint(obj["id"])
 			}
-		} else {
-			exampleVal = prop.Example
 		}
 
-		payload[key] = exampleVal
+		if val == nil {
+			g.name = name
+			val = g.schema(header.schema())
+		}
+
+		if val == nil {
+			continue
+		}
+
+		values[name] = headerValue(val)
 	}
 
-	return payload
+	return values
+}
+
+// Format a value for a header, arrays are comma separated as per the default v2 collectionFormat
+func headerValue(val any) string {
+	if items, isArray := val.([]any); isArray {
+		parts := make([]string, 0, len(items))
+		for _, item := range items {
+			parts = append(parts, fmt.Sprint(item))
+		}
+
+		return strings.Join(parts, ",")
+	}
+
+	return fmt.Sprint(val)
+}
+
+// Media types the response can be returned as, in order of preference
+// The produces of the whole spec are used when the operation has none
+func (op Operation) producesFor(resp Response, specProduces []string) []string {
+	if len(resp.Produces) > 0 {
+		return resp.Produces
+	}
+
+	if len(op.Produces) > 0 {
+		return op.Produces
+	}
+
+	if len(specProduces) > 0 {
+		return specProduces
+	}
+
+	return []string{contentType}
+}
+
+// Find the response to use for a status code, returning the key in the responses map
+// and the status code to send. Ranges like 2XX & the default response are supported
+func (op Operation) pickResponse(status int, requested bool) (string, int) {
+	// Never send a status that can't be written, such as 0 from a bad header
+	if status < 100 || status > 599 {
+		status, requested = http.StatusOK, false
+	}
+
+	statusKey := strconv.Itoa(status)
+	if _, exists := op.Responses[statusKey]; exists {
+		return statusKey, status
+	}
+
+	rangeKey := statusKey[:1] + "XX"
+	for _, key := range []string{rangeKey, strings.ToLower(rangeKey)} {
+		if _, exists := op.Responses[key]; exists {
+			return key, status
+		}
+	}
+
+	// The default response covers any status not listed, but only if one was asked for
+	if _, exists := op.Responses["default"]; exists && requested {
+		return "default", status
+	}
+
+	// No matching response, fall back to the first listed status code
+	logger.Warn("No response matching status, falling back to first response", slog.Any("status", status))
+
+	for _, key := range sortedKeys(op.Responses) {
+		if code, err := strconv.Atoi(key); err == nil {
+			return key, code
+		}
+
+		if len(key) == 3 && strings.HasSuffix(strings.ToUpper(key), "XX") {
+			code, _ := strconv.Atoi(key[:1] + "00")
+			return key, code
+		}
+	}
+
+	// Only a default response, so it's used with the status that was asked for
+	return "default", status
+}
+
+// A status code which can be sent, as a string from a header or spec
+func validStatus(code string) bool {
+	status, err := strconv.Atoi(code)
+
+	return err == nil && status >= 100 && status <= 599
+}
+
+// Pick one of the named examples, either the one requested or using the strategy
+func (resp Response) pickExample(g *generator) interface{} {
+	names := sortedKeys(resp.NamedExamples)
+
+	if g.example != "" {
+		if ex, exists := resp.NamedExamples[g.example]; exists {
+			return ex
+		}
+
+		logger.Warn("Requested example not found", slog.Any("example", g.example), slog.Any("available", names))
+	}
+
+	name := names[0]
+
+	switch g.exampleStrategy {
+	case strategyRandom:
+		// Not the seeded generator, as that would pick the same example every time
+		name = names[rand.Intn(len(names))] //nolint:gosec // Not used for security
+	case strategyRoundRobin:
+		name = names[g.sequence%len(names)]
+	}
+
+	logger.Debug("Using named example", slog.Any("example", name))
+
+	return resp.NamedExamples[name]
 }
 
 // Some helper functions to make the code more readable
@@ -201,6 +627,89 @@ func (p PathSpec) isDelete() bool {
 	return p.Delete.Responses != nil || p.Delete.Description != ""
 }
 
+func (p PathSpec) isPatch() bool {
+	return p.Patch.Responses != nil || p.Patch.Description != ""
+}
+
+func (p PathSpec) isHead() bool {
+	return p.Head.Responses != nil || p.Head.Description != ""
+}
+
+func (p PathSpec) isOptions() bool {
+	return p.Options.Responses != nil || p.Options.Description != ""
+}
+
+func (p PathSpec) isTrace() bool {
+	return p.Trace.Responses != nil || p.Trace.Description != ""
+}
+
+// All operations defined on the path, keyed by HTTP method
+func (p PathSpec) operations() map[string]Operation {
+	ops := make(map[string]Operation)
+
+	if p.isGet() {
+		ops[http.MethodGet] = p.Get
+	}
+
+	if p.isPost() {
+		ops[http.MethodPost] = p.Post
+	}
+
+	if p.isPut() {
+		ops[http.MethodPut] = p.Put
+	}
+
+	if p.isDelete() {
+		ops[http.MethodDelete] = p.Delete
+	}
+
+	if p.isPatch() {
+		ops[http.MethodPatch] = p.Patch
+	}
+
+	if p.isHead() {
+		ops[http.MethodHead] = p.Head
+	}
+
+	if p.isOptions() {
+		ops[http.MethodOptions] = p.Options
+	}
+
+	if p.isTrace() {
+		ops[http.MethodTrace] = p.Trace
+	}
+
+	// Parameters on the path apply to every operation, unless overridden by the operation
+	for method, op := range ops {
+		op.Parameters = mergeParameters(p.Parameters, op.Parameters)
+		ops[method] = op
+	}
+
+	return ops
+}
+
+// Combine path & operation parameters, a parameter is identified by its name & location
+func mergeParameters(pathParams, opParams []Parameters) []Parameters {
+	merged := []Parameters{}
+
+	for _, pathParam := range pathParams {
+		overridden := false
+
+		for _, opParam := range opParams {
+			if opParam.Name == pathParam.Name && opParam.In == pathParam.In {
+				overridden = true
+				break
+			}
+		}
+
+		if !overridden {
+			merged = append(merged, pathParam)
+		}
+	}
+
+	return append(merged, opParams...)
+}
+
 func (s Schema) isRef() bool {
 	return s.Ref != ""
 }
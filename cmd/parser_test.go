@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/json"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 )
@@ -120,14 +123,14 @@ func TestResponseParser(t *testing.T) {
 
 	// Test parsing an empty response
 	t.Run("empty", func(t *testing.T) {
-		if emptyResp.parse() != nil {
+		if emptyResp.parse(nil) != nil {
 			t.Error("expected nil data from response.parse()")
 		}
 	})
 
 	// Test parsing a response with an example
 	t.Run("resp_example_json", func(t *testing.T) {
-		data := respExampleJSON.parse()
+		data := respExampleJSON.parse(nil)
 		if data == nil {
 			t.Error("expected data from response.parse()")
 		}
@@ -151,8 +154,622 @@ func TestResponseParser(t *testing.T) {
 	})
 
 	t.Run("resp_example_plain", func(t *testing.T) {
-		if respExamplePlain.parse() != nil {
+		if respExamplePlain.parse(nil) != nil {
 			t.Error("expected nil data from response.parse()")
 		}
 	})
 }
+
+func TestV3Parser(t *testing.T) {
+	specV2, err := ParseSpec("../samples/petstore-v3.yaml")
+	if err != nil {
+		t.Fatalf("failed to parse v3 spec, got: %v", err)
+	}
+
+	t.Run("base_path", func(t *testing.T) {
+		if specV2.BasePath != "/v1" {
+			t.Errorf("expected base path '/v1', got: %v", specV2.BasePath)
+		}
+	})
+
+	t.Run("operations", func(t *testing.T) {
+		pets := specV2.Paths["/pets"]
+		if !pets.isGet() || !pets.isPost() {
+			t.Error("expected GET & POST operations on /pets")
+		}
+
+		if pets.isPut() {
+			t.Error("did not expect PUT operation on /pets")
+		}
+
+		if len(pets.Post.Parameters) != 1 || pets.Post.Parameters[0].In != "body" {
+			t.Errorf("expected request body as a body parameter, got: %v", pets.Post.Parameters)
+		}
+	})
+
+	t.Run("component_refs", func(t *testing.T) {
+		petByID := specV2.Paths["/pets/{petId}"]
+		if len(petByID.Parameters) != 1 || petByID.Parameters[0].Name != "petId" {
+			t.Errorf("expected petId parameter resolved from components, got: %v", petByID.Parameters)
+		}
+
+		if petByID.Get.Responses["404"].Description != "Unexpected error" {
+			t.Error("expected 404 response resolved from components")
+		}
+	})
+
+	t.Run("named_example", func(t *testing.T) {
+		resp := specV2.Paths["/pets/{petId}"].Get.Responses["200"]
+
+		data, ok := resp.parse(specV2.Definitions).(map[string]any)
+		if !ok {
+			t.Fatal("expected data to be a map")
+		}
+
+		if data["name"] != "Fluffy" {
+			t.Errorf("expected example value 'Fluffy', got: %v", data["name"])
+		}
+	})
+
+	t.Run("schema_ref", func(t *testing.T) {
+		resp := specV2.Paths["/pets"].Get.Responses["200"]
+
+		data, ok := resp.parse(specV2.Definitions).([]any)
+		if !ok || len(data) != 1 {
+			t.Fatalf("expected array payload, got: %v", resp.parse(specV2.Definitions))
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		tempFile, err := os.CreateTemp("", "*.json")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(tempFile.Name())
+
+		_, _ = tempFile.Write([]byte(`{ "info": { "title": "No version" }, "paths": {} }`))
+		tempFile.Close()
+
+		if _, err := ParseSpec(tempFile.Name()); err == nil {
+			t.Error("did not fail with spec missing version")
+		}
+	})
+}
+
+func TestV31Parser(t *testing.T) {
+	specYAML := `
+openapi: "3.1.0"
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /things:
+    get:
+      responses:
+        "200":
+          description: A thing
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Thing"
+webhooks:
+  newThing:
+    post:
+      responses:
+        "200":
+          description: Received
+components:
+  schemas:
+    Thing:
+      type: object
+      properties:
+        name:
+          type: [string, "null"]
+          examples: [Widget, Gadget]
+        kind:
+          const: gizmo
+        size:
+          $ref: "#/$defs/Size"
+      $defs:
+        Size:
+          type: [array]
+          prefixItems:
+            - type: integer
+              const: 10
+            - type: string
+              examples: [cm]
+`
+
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, _ = tempFile.Write([]byte(specYAML))
+	tempFile.Close()
+
+	specV2, err := ParseSpec(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to parse v3.1 spec, got: %v", err)
+	}
+
+	t.Run("type_array", func(t *testing.T) {
+		nameType := specV2.Definitions["Thing"].Properties["name"].Type
+		if !nameType.is("null") || nameType.primary() != "string" {
+			t.Errorf("expected type of [string, null], got: %v", nameType)
+		}
+	})
+
+	t.Run("defs_hoisted", func(t *testing.T) {
+		if _, ok := specV2.Definitions["Size"]; !ok {
+			t.Error("expected $defs to be available as definitions")
+		}
+	})
+
+	t.Run("payload", func(t *testing.T) {
+		data, ok := specV2.Paths["/things"].Get.Responses["200"].parse(specV2.Definitions).(map[string]any)
+		if !ok {
+			t.Fatal("expected data to be a map")
+		}
+
+		if data["name"] != "Widget" {
+			t.Errorf("expected first of examples 'Widget', got: %v", data["name"])
+		}
+
+		if data["kind"] != "gizmo" {
+			t.Errorf("expected const value 'gizmo', got: %v", data["kind"])
+		}
+	})
+
+	t.Run("json_type_array", func(t *testing.T) {
+		var s Schema
+		if err := json.Unmarshal([]byte(`{ "type": ["integer", "null"] }`), &s); err != nil {
+			t.Fatal(err)
+		}
+
+		if s.Type.primary() != "integer" {
+			t.Errorf("expected primary type 'integer', got: %v", s.Type.primary())
+		}
+
+		if err := json.Unmarshal([]byte(`{ "type": 42 }`), &s); err == nil {
+			t.Error("did not fail with invalid type")
+		}
+	})
+}
+
+func TestPathOperations(t *testing.T) {
+	pathSpec := PathSpec{
+		Get:     Operation{Description: "Get a thing"},
+		Patch:   Operation{Responses: Responses{"200": Response{}}},
+		Trace:   Operation{Responses: Responses{"200": Response{}}},
+		Options: Operation{},
+	}
+
+	ops := pathSpec.operations()
+	for _, method := range []string{"GET", "PATCH", "TRACE"} {
+		if _, ok := ops[method]; !ok {
+			t.Errorf("expected %s operation", method)
+		}
+	}
+
+	for _, method := range []string{"POST", "PUT", "DELETE", "HEAD", "OPTIONS"} {
+		if _, ok := ops[method]; ok {
+			t.Errorf("did not expect %s operation", method)
+		}
+	}
+}
+
+func TestComposition(t *testing.T) {
+	specYAML := `
+openapi: "3.0.3"
+info:
+  title: Test API
+  version: 1.0.0
+paths: {}
+components:
+  schemas:
+    Pet:
+      type: object
+      discriminator:
+        propertyName: petType
+        mapping:
+          kitty: "#/components/schemas/Cat"
+      properties:
+        name:
+          type: string
+          example: Rex
+        petType:
+          type: string
+    Cat:
+      allOf:
+        - $ref: "#/components/schemas/Pet"
+        - type: object
+          properties:
+            huntingSkill:
+              type: string
+              example: lazy
+    Dog:
+      allOf:
+        - $ref: "#/components/schemas/Pet"
+        - type: object
+          properties:
+            packSize:
+              type: integer
+              example: 3
+    AnyPet:
+      oneOf:
+        - $ref: "#/components/schemas/Cat"
+        - $ref: "#/components/schemas/Dog"
+      discriminator:
+        propertyName: petType
+        mapping:
+          kitty: "#/components/schemas/Cat"
+`
+
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, _ = tempFile.Write([]byte(specYAML))
+	tempFile.Close()
+
+	specV2, err := ParseSpec(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to parse spec, got: %v", err)
+	}
+
+	ref := func(name string) Schema {
+		return Schema{Ref: "#/components/schemas/" + name}
+	}
+
+	t.Run("all_of", func(t *testing.T) {
+		data, ok := newGenerator(specV2.Definitions).schema(ref("Dog")).(map[string]any)
+		if !ok {
+			t.Fatal("expected data to be a map")
+		}
+
+		if data["name"] != "Rex" || data["packSize"] != uint64(3) {
+			t.Errorf("expected properties merged from all subschemas, got: %v", data)
+		}
+
+		if data["petType"] != "Dog" {
+			t.Errorf("expected discriminator set to 'Dog', got: %v", data["petType"])
+		}
+	})
+
+	t.Run("all_of_mapping", func(t *testing.T) {
+		data := newGenerator(specV2.Definitions).schema(ref("Cat")).(map[string]any)
+		if data["petType"] != "kitty" {
+			t.Errorf("expected discriminator set from mapping to 'kitty', got: %v", data["petType"])
+		}
+	})
+
+	t.Run("one_of_default", func(t *testing.T) {
+		data := newGenerator(specV2.Definitions).schema(ref("AnyPet")).(map[string]any)
+		if data["huntingSkill"] != "lazy" || data["petType"] != "kitty" {
+			t.Errorf("expected first branch Cat, got: %v", data)
+		}
+	})
+
+	t.Run("one_of_variant", func(t *testing.T) {
+		for _, variant := range []string{"1", "Dog"} {
+			gen := newGenerator(specV2.Definitions)
+			gen.variant = variant
+
+			data := gen.schema(ref("AnyPet")).(map[string]any)
+			if data["packSize"] == nil || data["petType"] != "Dog" {
+				t.Errorf("expected branch Dog for variant %s, got: %v", variant, data)
+			}
+		}
+	})
+
+	t.Run("v2_discriminator", func(t *testing.T) {
+		var s Schema
+		if err := json.Unmarshal([]byte(`{ "discriminator": "petType" }`), &s); err != nil {
+			t.Fatal(err)
+		}
+
+		if s.Discriminator.PropertyName != "petType" {
+			t.Errorf("expected discriminator property 'petType', got: %v", s.Discriminator.PropertyName)
+		}
+	})
+}
+
+func TestGenerator(t *testing.T) {
+	specYAML := `
+swagger: "2.0"
+info:
+  title: Test API
+  version: 1.0.0
+paths: {}
+definitions:
+  Node:
+    type: object
+    properties:
+      name:
+        type: string
+        example: root
+      parent:
+        $ref: "#/definitions/Node"
+      children:
+        type: array
+        items:
+          $ref: "#/definitions/Node"
+  Order:
+    type: object
+    properties:
+      lines:
+        type: array
+        items:
+          type: object
+          properties:
+            qty:
+              type: integer
+              example: 2
+            product:
+              $ref: "#/definitions/Product"
+      tags:
+        type: object
+        additionalProperties:
+          type: string
+  Product:
+    properties:
+      sku:
+        type: string
+        example: ABC-123
+`
+
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, _ = tempFile.Write([]byte(specYAML))
+	tempFile.Close()
+
+	specV2, err := ParseSpec(tempFile.Name())
+	if err != nil {
+		t.Fatalf("failed to parse spec, got: %v", err)
+	}
+
+	t.Run("nested_refs", func(t *testing.T) {
+		data := newGenerator(specV2.Definitions).schema(Schema{Ref: "#/definitions/Order"}).(map[string]any)
+
+		lines, ok := data["lines"].([]any)
+		if !ok || len(lines) != 1 {
+			t.Fatalf("expected array of one order line, got: %v", data["lines"])
+		}
+
+		product := lines[0].(map[string]any)["product"].(map[string]any)
+		if product["sku"] != "ABC-123" {
+			t.Errorf("expected product resolved from ref, got: %v", product)
+		}
+
+		tags := data["tags"].(map[string]any)
+		if tags["key1"] != "string" {
+			t.Errorf("expected additionalProperties values generated, got: %v", tags)
+		}
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		data := newGenerator(specV2.Definitions).schema(Schema{Ref: "#/definitions/Node"}).(map[string]any)
+
+		if data["name"] != "root" || data["parent"] != nil {
+			t.Errorf("expected self reference not to be expanded, got: %v", data)
+		}
+
+		if children := data["children"].([]any); len(children) != 0 {
+			t.Errorf("expected no children, got: %v", children)
+		}
+	})
+
+	t.Run("max_depth", func(t *testing.T) {
+		gen := newGenerator(specV2.Definitions)
+		gen.maxDepth = 2
+
+		data := gen.schema(Schema{Ref: "#/definitions/Order"}).(map[string]any)
+		lines := data["lines"].([]any)
+		if len(lines) != 0 {
+			t.Errorf("expected lines to be cut off at max depth, got: %v", lines)
+		}
+	})
+
+	t.Run("additional_props_bool", func(t *testing.T) {
+		var s Schema
+		if err := json.Unmarshal([]byte(`{ "type": "object", "additionalProperties": false }`), &s); err != nil {
+			t.Fatal(err)
+		}
+
+		if s.AdditionalProperties == nil || s.AdditionalProperties.Allowed {
+			t.Error("expected additionalProperties to be false")
+		}
+	})
+}
+
+func TestNamedExamples(t *testing.T) {
+	resp := Response{
+		NamedExamples: map[string]any{
+			"cat": map[string]any{"name": "Fluffy"},
+			"dog": map[string]any{"name": "Rex"},
+		},
+	}
+
+	name := func(payload any) any {
+		return payload.(map[string]any)["name"]
+	}
+
+	t.Run("first", func(t *testing.T) {
+		if got := name(resp.parse(nil)); got != "Fluffy" {
+			t.Errorf("expected first example 'Fluffy', got: %v", got)
+		}
+	})
+
+	t.Run("requested", func(t *testing.T) {
+		gen := newGenerator(nil)
+		gen.example = "dog"
+
+		if got := name(resp.parseWith(gen)); got != "Rex" {
+			t.Errorf("expected requested example 'Rex', got: %v", got)
+		}
+	})
+
+	t.Run("requested_missing", func(t *testing.T) {
+		gen := newGenerator(nil)
+		gen.example = "hamster"
+
+		if got := name(resp.parseWith(gen)); got != "Fluffy" {
+			t.Errorf("expected fallback to first example 'Fluffy', got: %v", got)
+		}
+	})
+
+	t.Run("round_robin", func(t *testing.T) {
+		gen := newGenerator(nil)
+		gen.exampleStrategy = strategyRoundRobin
+
+		for i, expected := range []string{"Fluffy", "Rex", "Fluffy"} {
+			gen.sequence = i
+			if got := name(resp.parseWith(gen)); got != expected {
+				t.Errorf("expected example %s for request %d, got: %v", expected, i, got)
+			}
+		}
+	})
+
+	t.Run("v2_x_examples", func(t *testing.T) {
+		var r Response
+		err := json.Unmarshal([]byte(`{ "description": "ok", "x-examples": { "one": 1, "two": 2 } }`), &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(r.NamedExamples) != 2 {
+			t.Errorf("expected 2 named examples, got: %v", r.NamedExamples)
+		}
+	})
+
+	t.Run("v3_examples", func(t *testing.T) {
+		specV2, err := ParseSpec("../samples/petstore-v3.yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		named := specV2.Paths["/pets/{petId}"].Get.Responses["200"].NamedExamples
+		if _, ok := named["fluffy"]; !ok {
+			t.Errorf("expected named example 'fluffy', got: %v", named)
+		}
+	})
+}
+
+func TestPickResponse(t *testing.T) {
+	op := Operation{Responses: Responses{
+		"404":     Response{},
+		"201":     Response{},
+		"5XX":     Response{},
+		"default": Response{},
+	}}
+
+	tests := []struct {
+		name      string
+		status    int
+		requested bool
+		key       string
+		code      int
+	}{
+		{"exact", 404, true, "404", 404},
+		{"range", 503, true, "5XX", 503},
+		{"default", 418, true, "default", 418},
+		{"fallback", 200, false, "201", 201},
+		{"invalid", 0, true, "201", 201},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, code := op.pickResponse(test.status, test.requested)
+			if key != test.key || code != test.code {
+				t.Errorf("expected %s & %d, got: %s & %d", test.key, test.code, key, code)
+			}
+		})
+	}
+
+	t.Run("only_default", func(t *testing.T) {
+		op := Operation{Responses: Responses{"default": Response{}}}
+		for _, status := range []int{200, 0, 1000} {
+			if key, code := op.pickResponse(status, true); key != "default" || code != 200 {
+				t.Errorf("expected default & 200 for %d, got: %s & %d", status, key, code)
+			}
+		}
+	})
+
+	t.Run("bad_header", func(t *testing.T) {
+		op := Operation{Responses: Responses{"default": Response{}}}
+		handler := createResponseHandler(mockRoute{api: &mockAPI{}, op: op})
+
+		for _, code := range []string{"abc", "0", "42", "600"} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("x-mock-response-code", code)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("expected 400 for response code '%s', got: %d", code, rec.Code)
+			}
+		}
+	})
+}
+
+func TestResponseHeaders(t *testing.T) {
+	specV3, err := ParseSpec("../samples/petstore-v3.yaml")
+	if err != nil {
+		t.Fatalf("failed to parse v3 spec, got: %v", err)
+	}
+
+	t.Run("v3_ref_example", func(t *testing.T) {
+		resp := specV3.Paths["/pets"].Get.Responses["200"]
+		headers := resp.headerValues(newGenerator(specV3.Definitions), "/v1/pets", nil)
+
+		if headers["X-Rate-Limit-Remaining"] != "99" {
+			t.Errorf("expected X-Rate-Limit-Remaining of 99, got: %v", headers)
+		}
+	})
+
+	t.Run("location", func(t *testing.T) {
+		resp := specV3.Paths["/pets"].Post.Responses["201"]
+		headers := resp.headerValues(newGenerator(specV3.Definitions), "/v1/pets", map[string]any{"id": 42})
+
+		if headers["Location"] != "/v1/pets/42" {
+			t.Errorf("expected Location of /v1/pets/42, got: %v", headers)
+		}
+	})
+
+	t.Run("v2_inline", func(t *testing.T) {
+		var resp Response
+		data := `{ "headers": {
+			"ETag": { "type": "string", "x-example": "abc123" },
+			"X-Count": { "type": "integer", "minimum": 1 },
+			"X-Tags": { "type": "array", "items": { "type": "string", "enum": ["a"] } },
+			"X-Mode": { "type": "string", "default": "fast" },
+			"Content-Type": { "type": "string" }
+		} }`
+
+		if err := json.Unmarshal([]byte(data), &resp); err != nil {
+			t.Fatal(err)
+		}
+
+		headers := resp.headerValues(newGenerator(nil), "/", nil)
+		expected := map[string]string{"ETag": "abc123", "X-Count": "1", "X-Tags": "a", "X-Mode": "fast"}
+
+		if len(headers) != len(expected) {
+			t.Errorf("expected headers %v, got: %v", expected, headers)
+		}
+
+		for name, val := range expected {
+			if headers[name] != val {
+				t.Errorf("expected %s of %s, got: %s", name, val, headers[name])
+			}
+		}
+	})
+}
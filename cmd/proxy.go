@@ -0,0 +1,364 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Proxying to a real upstream, recording what it sends back & playing it back
+// ----------------------------------------------------------------------------
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lmittmann/tint"
+)
+
+// A request sent to the upstream & the response that came back
+type recording struct {
+	Request  recordedRequest  `json:"request"`
+	Response recordedResponse `json:"response"`
+}
+
+type recordedRequest struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Body   any    `json:"body,omitempty"`
+}
+
+type recordedResponse struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    any               `json:"body,omitempty"`
+}
+
+// Recordings for each operation, saved in a JSON file per operation named after it
+type recordingStore struct {
+	lock   sync.RWMutex
+	byName map[string][]recording
+}
+
+// Set up by setupProxy, upstream is nil unless proxying
+var (
+	upstream   *httputil.ReverseProxy
+	recordings = &recordingStore{byName: map[string][]recording{}}
+)
+
+type recordingKey struct{}
+
+// Headers which only make sense for the connection they came on, so aren't recorded
+var skippedHeaders = map[string]bool{
+	"Connection": true, "Content-Length": true, "Date": true, "Keep-Alive": true, "Transfer-Encoding": true,
+}
+
+var unsafeNameRegex = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// Set up proxying, recording & playback from the config
+func setupProxy() error {
+	if config.record != "" && config.proxyTarget == "" {
+		return errors.New("recording needs -proxy-target, so there's something to record")
+	}
+
+	if config.proxyTarget != "" {
+		proxy, err := newUpstreamProxy(config.proxyTarget)
+		if err != nil {
+			return err
+		}
+
+		upstream = proxy
+	}
+
+	return recordings.loadAll()
+}
+
+// Reverse proxy which sends requests to the upstream as they are, recording responses if enabled
+func newUpstreamProxy(target string) (*httputil.ReverseProxy, error) {
+	targetURL, err := url.Parse(target)
+	if err != nil || targetURL.Scheme == "" || targetURL.Host == "" {
+		return nil, fmt.Errorf("proxy target '%s' is not a valid URL", target)
+	}
+
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(targetURL)
+			pr.SetXForwarded()
+
+			// Without the client's Accept-Encoding the transport asks for gzip & decompresses
+			// it itself, so responses are recorded as plain text rather than compressed bytes
+			pr.Out.Header.Del("Accept-Encoding")
+		},
+
+		ModifyResponse: recordResponse,
+
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			logger.Error("Proxy request failed", slog.Any("target", target), tint.Err(err))
+			writeProblem(w, r, http.StatusBadGateway, "Unable to reach the upstream: "+err.Error(), nil)
+		},
+	}, nil
+}
+
+// Send a request to the upstream, it's recorded under the name when recording
+func proxyRequest(w http.ResponseWriter, r *http.Request, name string) {
+	logger.Info("Proxying request", slog.Any("method", r.Method), slog.Any("path", r.URL.Path))
+
+	if config.record != "" && name != "" {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		rec := &recording{Request: recordedRequest{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+			Body:   decodeRecordedBody(r.Header.Get("Content-Type"), body),
+		}}
+
+		r = r.WithContext(context.WithValue(r.Context(), recordingKey{}, &namedRecording{name, rec}))
+	}
+
+	upstream.ServeHTTP(w, r)
+}
+
+type namedRecording struct {
+	name string
+	rec  *recording
+}
+
+// Called by the proxy with the upstream response, the body is read & put back for the client
+func recordResponse(resp *http.Response) error {
+	pending, isRecording := resp.Request.Context().Value(recordingKey{}).(*namedRecording)
+	if !isRecording {
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	headers := map[string]string{}
+
+	for name := range resp.Header {
+		if !skippedHeaders[name] {
+			headers[name] = resp.Header.Get(name)
+		}
+	}
+
+	pending.rec.Response = recordedResponse{
+		Status:  resp.StatusCode,
+		Headers: headers,
+		Body:    decodeRecordedBody(resp.Header.Get("Content-Type"), body),
+	}
+
+	recordings.add(pending.name, *pending.rec)
+
+	return nil
+}
+
+// Existing recordings are loaded when recording, so they're kept when the files are written
+func (s *recordingStore) loadAll() error {
+	for _, dir := range []string{config.playback, config.record} {
+		if dir == "" {
+			continue
+		}
+
+		if err := s.load(dir); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Forget all the recordings & load them again, so any changes to the files are picked up
+func (s *recordingStore) reset() error {
+	s.lock.Lock()
+	s.byName = map[string][]recording{}
+	s.lock.Unlock()
+
+	return s.loadAll()
+}
+
+// Load every recording file in a directory, a missing directory is fine as it's created when recording
+func (s *recordingStore) load(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		recs := []recording{}
+		if err := json.Unmarshal(data, &recs); err != nil {
+			return fmt.Errorf("recording file %s is not valid: %w", file, err)
+		}
+
+		s.byName[strings.TrimSuffix(filepath.Base(file), ".json")] = recs
+	}
+
+	logger.Info("Loaded recordings", slog.Any("dir", dir), slog.Any("operations", len(files)))
+
+	return nil
+}
+
+// Add a recording & save the file for the operation, a newer recording of the
+// same request with the same status replaces the older one
+func (s *recordingStore) add(name string, rec recording) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	recs := []recording{}
+
+	for _, old := range s.byName[name] {
+		if old.Request.Method != rec.Request.Method || old.Request.Path != rec.Request.Path ||
+			old.Request.Query != rec.Request.Query || old.Response.Status != rec.Response.Status {
+			recs = append(recs, old)
+		}
+	}
+
+	recs = append(recs, rec)
+	s.byName[name] = recs
+
+	if err := writeRecordings(filepath.Join(config.record, name+".json"), recs); err != nil {
+		logger.Error("Failed to save recording", slog.Any("operation", name), tint.Err(err))
+		return
+	}
+
+	logger.Info("Recorded response", slog.Any("operation", name), slog.Any("status", rec.Response.Status))
+}
+
+// Find the best recording for a request, one for the same path & query, then the same path
+// Recordings of other paths are never used, as they are for different resources, e.g. /pets/1
+// With a status, only recordings with that status are used. A copy is returned as recordings can be replaced
+func (s *recordingStore) find(name string, r *http.Request, status int) *recording {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	var best *recording
+
+	for _, rec := range s.byName[name] {
+		if rec.Request.Method != r.Method || rec.Request.Path != r.URL.Path ||
+			(status != 0 && rec.Response.Status != status) {
+			continue
+		}
+
+		if best == nil || rec.Request.Query == r.URL.RawQuery {
+			rec := rec
+			best = &rec
+		}
+
+		if best.Request.Query == r.URL.RawQuery {
+			break
+		}
+	}
+
+	return best
+}
+
+// Send a recorded response, strings are sent as they are & anything else as JSON
+func (rec *recording) respond(w http.ResponseWriter) {
+	for name, val := range rec.Response.Headers {
+		w.Header().Set(name, val)
+	}
+
+	var body []byte
+
+	switch val := rec.Response.Body.(type) {
+	case nil:
+	case string:
+		body = []byte(val)
+	default:
+		body, _ = json.Marshal(val)
+	}
+
+	w.WriteHeader(rec.Response.Status)
+	_, _ = w.Write(body)
+}
+
+// Written to a temp file then renamed, like the store file
+func writeRecordings(path string, recs []recording) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// HTML isn't escaped, so recorded bodies are easy to read
+	data := &bytes.Buffer{}
+	enc := json.NewEncoder(data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(recs); err != nil {
+		return err
+	}
+
+	tempPath := path + ".tmp"
+	if err := os.WriteFile(tempPath, data.Bytes(), 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, path)
+}
+
+// JSON bodies are kept as JSON so the files are easy to read & edit, anything else as a string
+// A JSON string is kept as it was, quotes & all, as strings are sent back as they are
+func decodeRecordedBody(mediaType string, body []byte) any {
+	if len(body) == 0 {
+		return nil
+	}
+
+	var val any
+	if isJSON(mediaType) && json.Unmarshal(body, &val) == nil {
+		if _, isString := val.(string); !isString {
+			return val
+		}
+	}
+
+	return string(body)
+}
+
+// When proxying, operations picked with x-mock, -mock-tags or -mock-ops are still mocked,
+// so an API which is only partly built can be used through mockery as if it was all there
+func isMocked(op Operation) bool {
+	if op.Mock || slices.Contains(config.mockOps, op.OperationID) {
+		return true
+	}
+
+	for _, tag := range op.Tags {
+		if slices.Contains(config.mockTags, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Name recordings are kept under, the operationId or the method & path when there isn't one
+func recordingName(route mockRoute) string {
+	name := route.op.OperationID
+	if name == "" {
+		name = strings.ToLower(route.method) + route.path
+	}
+
+	return strings.Trim(unsafeNameRegex.ReplaceAllString(name, "_"), "_")
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProxy(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"spec.yaml": `
+swagger: "2.0"
+info:
+  title: Proxied
+  version: 1.0.0
+paths:
+  /pets/{petId}:
+    get:
+      operationId: getPet
+      responses:
+        "200":
+          description: OK
+          examples:
+            application/json: "from spec"
+        "404":
+          description: Not found
+  /owners:
+    get:
+      responses:
+        "200":
+          description: OK
+          examples:
+            application/json: "from spec"
+`,
+	})
+
+	real := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/pets/404" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("x-real", "yes")
+		body := []byte(`{"path": "` + r.URL.Path + `", "query": "` + r.URL.RawQuery + `"}`)
+
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			_, _ = gz.Write(body)
+			_ = gz.Close()
+
+			return
+		}
+
+		_, _ = w.Write(body)
+	}))
+	defer real.Close()
+
+	apis, err := loadAPIs([]string{filepath.Join(dir, "spec.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recordDir := filepath.Join(t.TempDir(), "recordings")
+
+	defer func() {
+		config.proxyTarget = ""
+		config.record = ""
+		config.playback = ""
+		upstream = nil
+		recordings = &recordingStore{byName: map[string][]recording{}}
+	}()
+
+	send := func(router http.Handler, target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for name, val := range headers {
+			req.Header.Set(name, val)
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	t.Run("record", func(t *testing.T) {
+		config.proxyTarget = real.URL
+		config.record = recordDir
+
+		if err := setupProxy(); err != nil {
+			t.Fatal(err)
+		}
+
+		router, err := newRouter(apis)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := send(router, "/pets/1?full=true", nil)
+		if rec.Header().Get("x-real") != "yes" || !strings.Contains(rec.Body.String(), `"query": "full=true"`) {
+			t.Errorf("expected response from upstream, got: %s", rec.Body.String())
+		}
+
+		send(router, "/pets/404", nil)
+
+		// Compressed responses are recorded decompressed
+		rec = send(router, "/owners", map[string]string{"Accept-Encoding": "gzip"})
+		if !strings.Contains(rec.Body.String(), "/owners") {
+			t.Errorf("expected plain response from upstream, got: %q", rec.Body.String())
+		}
+
+		// Paths not in the spec are proxied but not recorded
+		if rec := send(router, "/other", nil); !strings.Contains(rec.Body.String(), "/other") {
+			t.Errorf("expected unknown path to be proxied, got: %s", rec.Body.String())
+		}
+
+		files, _ := filepath.Glob(filepath.Join(recordDir, "*.json"))
+		if len(files) != 2 || filepath.Base(files[0]) != "getPet.json" || filepath.Base(files[1]) != "get_owners.json" {
+			t.Errorf("expected a file per operation, got: %v", files)
+		}
+
+		data, _ := os.ReadFile(filepath.Join(recordDir, "getPet.json"))
+		if !strings.Contains(string(data), `"status": 404`) || strings.Contains(string(data), "Content-Length") {
+			t.Errorf("expected recorded responses without connection headers, got: %s", data)
+		}
+
+		data, _ = os.ReadFile(filepath.Join(recordDir, "get_owners.json"))
+		if !strings.Contains(string(data), `"path": "/owners"`) || strings.Contains(string(data), "Content-Encoding") {
+			t.Errorf("expected decompressed recording, got: %s", data)
+		}
+	})
+
+	t.Run("playback", func(t *testing.T) {
+		config.proxyTarget = ""
+		config.record = ""
+		config.playback = recordDir
+		upstream = nil
+		recordings = &recordingStore{byName: map[string][]recording{}}
+
+		if err := setupProxy(); err != nil {
+			t.Fatal(err)
+		}
+
+		real.Close()
+
+		router, err := newRouter(apis)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rec := send(router, "/pets/1", nil)
+		if rec.Code != 200 || rec.Header().Get("x-real") != "yes" || !strings.Contains(rec.Body.String(), `"/pets/1"`) {
+			t.Errorf("expected recorded response, got: %d %s", rec.Code, rec.Body.String())
+		}
+
+		// Recordings of other paths are for other resources
+		rec = send(router, "/pets/2", nil)
+		if rec.Header().Get("x-real") != "" || !strings.Contains(rec.Body.String(), "from spec") {
+			t.Errorf("expected response from spec for path not recorded, got: %s", rec.Body.String())
+		}
+
+		if rec := send(router, "/pets/404", map[string]string{"x-mock-response-code": "404"}); rec.Code != 404 {
+			t.Errorf("expected recorded 404, got: %d", rec.Code)
+		}
+
+		if rec := send(router, "/other", nil); rec.Code != 404 {
+			t.Errorf("expected unknown path not to be proxied, got: %d", rec.Code)
+		}
+	})
+
+	t.Run("string_body", func(t *testing.T) {
+		for body, expected := range map[string]string{`{oops`: `{oops`, `"hello"`: `"hello"`} {
+			rec := recording{Response: recordedResponse{
+				Status:  http.StatusOK,
+				Headers: map[string]string{"Content-Type": "application/json"},
+				Body:    decodeRecordedBody("application/json", []byte(body)),
+			}}
+
+			w := httptest.NewRecorder()
+			rec.respond(w)
+
+			if w.Body.String() != expected {
+				t.Errorf("expected %s to be sent as it was recorded, got: %s", body, w.Body.String())
+			}
+		}
+	})
+
+	t.Run("config", func(t *testing.T) {
+		config.playback = ""
+		config.record = recordDir
+
+		if err := setupProxy(); err == nil {
+			t.Errorf("expected error recording without a proxy target")
+		}
+
+		config.proxyTarget = "localhost:8080"
+		if err := setupProxy(); err == nil {
+			t.Errorf("expected error for proxy target without a scheme")
+		}
+	})
+}
+
+func TestPartialProxy(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"spec.yaml": `
+openapi: 3.0.0
+info:
+  title: Partly built
+  version: 1.0.0
+paths:
+  /built:
+    get:
+      responses:
+        "200":
+          description: OK
+  /flagged:
+    get:
+      x-mock: true
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              example: "mocked"
+  /tagged:
+    get:
+      tags: [new]
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              example: "mocked"
+  /listed:
+    get:
+      operationId: listed
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              example: "mocked"
+`,
+	})
+
+	real := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("real"))
+	}))
+	defer real.Close()
+
+	apis, err := loadAPIs([]string{filepath.Join(dir, "spec.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config.proxyTarget = real.URL
+	config.mockTags = listFlag{"new"}
+	config.mockOps = listFlag{"listed"}
+
+	defer func() {
+		config.proxyTarget = ""
+		config.mockTags = nil
+		config.mockOps = nil
+		upstream = nil
+	}()
+
+	if err := setupProxy(); err != nil {
+		t.Fatal(err)
+	}
+
+	router, err := newRouter(apis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]string{
+		"/built":   "real",
+		"/flagged": `"mocked"`,
+		"/tagged":  `"mocked"`,
+		"/listed":  `"mocked"`,
+		"/missing": "real",
+	}
+
+	for path, expected := range tests {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if body := strings.TrimSpace(rec.Body.String()); body != expected {
+			t.Errorf("expected %s from %s, got: %s", expected, path, body)
+		}
+	}
+
+	for _, route := range listRoutes(apis) {
+		if route.Proxied != (route.Path == "/built") {
+			t.Errorf("expected only /built to be listed as proxied, got: %+v", route)
+		}
+	}
+}
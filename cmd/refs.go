@@ -0,0 +1,548 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Resolving JSON References, including refs to other files
+// ----------------------------------------------------------------------------
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// Where a value sits in the spec, this decides how a $ref to it is resolved
+type refContext int
+
+const (
+	// Anything that isn't a schema, e.g. a parameter or response, refs are inlined
+	ctxOther refContext = iota
+	// A schema, refs are kept but pointed at a model in the definitions
+	ctxSchema
+	// Map of names to schemas, e.g. properties or definitions
+	ctxSchemaMap
+	// List of schemas, e.g. allOf
+	ctxSchemaList
+	// Discriminator, the mapping holds refs as strings
+	ctxDiscriminator
+	// Examples & other values which are data, and never contain refs
+	ctxLiteral
+)
+
+// Resolves all the refs in a spec, so the rest of mockery only has to deal with
+// refs to models in the definitions, which are looked up by name. Schemas in other
+// files, or nested deep in a document, are copied into the definitions with a
+// unique name. Refs to anything else (parameters, responses etc) are replaced
+// with the value they point to
+type refResolver struct {
+	rootFile string
+
+	// Prefix of refs to models, which depends on the version of the spec
+	modelPrefix string
+	isV3        bool
+
+	// Decoded files, keyed by absolute path
+	cache map[string]any
+
+	// Models in the root document, and those copied in from elsewhere
+	models  map[string]any
+	hoisted map[string]any
+
+	// Name given to each schema that has been copied in, keyed by absolute ref
+	names map[string]string
+
+	// Schemas in v3.1 $defs, keyed by name, for refs like #/$defs/Size
+	defs map[string]any
+
+	// Refs being inlined right now, to detect refs that include themselves
+	inlining []string
+}
+
+// Load a spec file with all refs resolved, then unmarshal it into out
+func loadResolvedSpec(filePath string, out any) error {
+	root, err := resolveSpec(filePath)
+	if err != nil {
+		return err
+	}
+
+	// Round trip in the original format, so values decode to the same types as before
+	// YAML is written in JSON style, so strings that look like other types are quoted
+	if isYAMLFile(filePath) {
+		data, err := yaml.MarshalWithOptions(root, yaml.JSON())
+		if err != nil {
+			return err
+		}
+
+		return yaml.Unmarshal(data, out)
+	}
+
+	data, err := json.Marshal(root)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, out)
+}
+
+// Load a spec file as a raw document, with all the refs resolved
+func resolveSpec(filePath string) (map[string]any, error) {
+	r, err := newRefResolver(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.resolve()
+}
+
+// All the files a spec is made from, the spec itself & any files it has refs to
+func specSourceFiles(filePath string) ([]string, error) {
+	r, err := newRefResolver(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.resolve(); err != nil {
+		return nil, err
+	}
+
+	return sortedKeys(r.cache), nil
+}
+
+func newRefResolver(filePath string) (*refResolver, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	return &refResolver{
+		rootFile:    absPath,
+		modelPrefix: "#/definitions/",
+		cache:       map[string]any{},
+		models:      map[string]any{},
+		hoisted:     map[string]any{},
+		names:       map[string]string{},
+		defs:        map[string]any{},
+	}, nil
+}
+
+func (r *refResolver) resolve() (map[string]any, error) {
+	doc, err := r.load(r.rootFile)
+	if err != nil {
+		return nil, err
+	}
+
+	root, isMap := doc.(map[string]any)
+	if !isMap {
+		return nil, fmt.Errorf("spec file %s is not an object", r.rootFile)
+	}
+
+	// Models live in a different place in v3
+	modelsPath := []string{"definitions"}
+	if _, r.isV3 = root["openapi"]; r.isV3 {
+		r.modelPrefix = "#/components/schemas/"
+		modelsPath = []string{"components", "schemas"}
+	}
+
+	if models, isMap := getPath(root, modelsPath).(map[string]any); isMap {
+		r.models = models
+	}
+
+	r.collectDefs(root, ctxOther)
+
+	resolved, err := r.walk(root, r.rootFile, ctxOther)
+	if err != nil {
+		return nil, err
+	}
+
+	resolvedRoot, _ := resolved.(map[string]any)
+
+	// Add any models copied in from other files or places in the document
+	if len(r.hoisted) > 0 {
+		models := ensurePath(resolvedRoot, modelsPath)
+		for name, model := range r.hoisted {
+			models[name] = model
+		}
+	}
+
+	return resolvedRoot, nil
+}
+
+// Load & decode a file, each file is only loaded once
+func (r *refResolver) load(absPath string) (any, error) {
+	if doc, cached := r.cache[absPath]; cached {
+		return doc, nil
+	}
+
+	var doc any
+	if err := loadSpecFile(absPath, &doc); err != nil {
+		return nil, err
+	}
+
+	if absPath != r.rootFile {
+		logger.Debug("Loaded referenced file", slog.Any("file", absPath))
+	}
+
+	r.cache[absPath] = doc
+
+	return doc, nil
+}
+
+// Copy a value, resolving refs as we go, the context is what kind of value it is
+func (r *refResolver) walk(node any, file string, ctx refContext) (any, error) {
+	if ctx == ctxLiteral {
+		return node, nil
+	}
+
+	switch n := node.(type) {
+	case map[string]any:
+		ref, isRef := n["$ref"].(string)
+		if isRef && ctx != ctxSchema && ctx != ctxSchemaMap {
+			return r.ref(ref, file, ctx)
+		}
+
+		out := make(map[string]any, len(n))
+
+		for _, key := range sortedKeys(n) {
+			val := n[key]
+
+			// Schemas keep any keywords alongside the ref, e.g. xml or description
+			if isRef && ctx == ctxSchema && key == "$ref" {
+				modelRef, err := r.modelRef(ref, file)
+				if err != nil {
+					return nil, err
+				}
+
+				out[key] = modelRef
+
+				continue
+			}
+
+			if ctx == ctxDiscriminator && key == "mapping" {
+				mapping, err := r.mapping(val, file)
+				if err != nil {
+					return nil, err
+				}
+
+				out[key] = mapping
+
+				continue
+			}
+
+			resolved, err := r.walk(val, file, childContext(ctx, key, r.isV3))
+			if err != nil {
+				return nil, err
+			}
+
+			out[key] = resolved
+		}
+
+		return out, nil
+
+	case []any:
+		itemCtx := ctx
+		if ctx == ctxSchemaList {
+			itemCtx = ctxSchema
+		}
+
+		out := make([]any, len(n))
+
+		for i, item := range n {
+			resolved, err := r.walk(item, file, itemCtx)
+			if err != nil {
+				return nil, err
+			}
+
+			out[i] = resolved
+		}
+
+		return out, nil
+	}
+
+	return node, nil
+}
+
+// Work out the context of a value in a map from the key & the context of the map
+// In v2 the examples of a response are payloads keyed by media type, but in v3
+// they are example objects, which can be refs
+func childContext(ctx refContext, key string, isV3 bool) refContext {
+	switch ctx {
+	case ctxSchemaMap:
+		return ctxSchema
+
+	case ctxSchema:
+		switch key {
+		case "properties", "patternProperties", "dependentSchemas", "$defs", "definitions":
+			return ctxSchemaMap
+		case "items", "additionalProperties", "not", "contains", "propertyNames", "if", "then", "else",
+			"additionalItems", "unevaluatedItems", "unevaluatedProperties":
+			return ctxSchema
+		case "allOf", "anyOf", "oneOf", "prefixItems":
+			return ctxSchemaList
+		case "discriminator":
+			return ctxDiscriminator
+		}
+
+		return ctxLiteral
+
+	case ctxOther:
+		switch key {
+		case "schema", "items":
+			return ctxSchema
+		case "definitions", "schemas":
+			return ctxSchemaMap
+		case "example", "value", "x-examples", "enum":
+			return ctxLiteral
+		case "examples":
+			if !isV3 {
+				return ctxLiteral
+			}
+		}
+	}
+
+	return ctxOther
+}
+
+// Find the $defs in all the schemas of a document, the first with a name wins
+func (r *refResolver) collectDefs(node any, ctx refContext) {
+	switch n := node.(type) {
+	case map[string]any:
+		if defs, isMap := n["$defs"].(map[string]any); isMap && ctx == ctxSchema {
+			for _, name := range sortedKeys(defs) {
+				if _, exists := r.defs[name]; !exists {
+					r.defs[name] = defs[name]
+				}
+			}
+		}
+
+		for _, key := range sortedKeys(n) {
+			r.collectDefs(n[key], childContext(ctx, key, r.isV3))
+		}
+
+	case []any:
+		itemCtx := ctx
+		if ctx == ctxSchemaList {
+			itemCtx = ctxSchema
+		}
+
+		for _, item := range n {
+			r.collectDefs(item, itemCtx)
+		}
+	}
+}
+
+// Resolve a ref to anything other than a schema, by inlining the value it points to
+func (r *refResolver) ref(ref, file string, ctx refContext) (any, error) {
+	targetFile, pointer, err := r.split(ref, file)
+	if err != nil {
+		return nil, err
+	}
+
+	key := targetFile + "#" + pointer
+	for _, inlining := range r.inlining {
+		if inlining == key {
+			return nil, fmt.Errorf("circular $ref '%s' in %s", ref, file)
+		}
+	}
+
+	target, found, err := r.target(targetFile, pointer)
+	if err != nil {
+		return nil, err
+	}
+
+	// Leave refs that can't be resolved as they were, so they can be reported later
+	if !found {
+		logger.Warn("Unable to resolve $ref", slog.Any("ref", ref), slog.Any("file", file))
+		return map[string]any{"$ref": ref}, nil
+	}
+
+	r.inlining = append(r.inlining, key)
+	defer func() { r.inlining = r.inlining[:len(r.inlining)-1] }()
+
+	return r.walk(target, targetFile, ctx)
+}
+
+// Get the ref to use for a schema, copying the schema into the models if it isn't one already
+func (r *refResolver) modelRef(ref, file string) (string, error) {
+	targetFile, pointer, err := r.split(ref, file)
+	if err != nil {
+		return "", err
+	}
+
+	// Refs to models in the root document are already what we want
+	tokens := pointerTokens(pointer)
+	if targetFile == r.rootFile && len(tokens) > 0 && r.modelPrefix+tokens[len(tokens)-1] == "#"+pointer {
+		return ref, nil
+	}
+
+	key := targetFile + "#" + pointer
+	if name, done := r.names[key]; done {
+		return r.modelPrefix + name, nil
+	}
+
+	target, found, err := r.target(targetFile, pointer)
+	if err != nil {
+		return "", err
+	}
+
+	// Refs to $defs are relative to the schema they are in, so are looked up by name
+	if !found && len(tokens) == 2 && tokens[0] == "$defs" {
+		target, found = r.defs[tokens[1]]
+	}
+
+	if !found {
+		logger.Warn("Unable to resolve $ref", slog.Any("ref", ref), slog.Any("file", file))
+		return ref, nil
+	}
+
+	// Name is registered before walking the schema, so refs back to it are not followed again
+	name := r.modelName(targetFile, tokens)
+	r.names[key] = name
+	r.hoisted[name] = nil
+
+	model, err := r.walk(target, targetFile, ctxSchema)
+	if err != nil {
+		return "", err
+	}
+
+	r.hoisted[name] = model
+
+	return r.modelPrefix + name, nil
+}
+
+// Discriminator mappings hold refs as strings, plain names are left as they are
+func (r *refResolver) mapping(val any, file string) (any, error) {
+	mapping, isMap := val.(map[string]any)
+	if !isMap {
+		return val, nil
+	}
+
+	out := make(map[string]any, len(mapping))
+
+	for key, target := range mapping {
+		ref, isString := target.(string)
+		if !isString || !strings.ContainsAny(ref, "#/.") {
+			out[key] = target
+			continue
+		}
+
+		modelRef, err := r.modelRef(ref, file)
+		if err != nil {
+			return nil, err
+		}
+
+		out[key] = modelRef
+	}
+
+	return out, nil
+}
+
+// Pick a unique name for a model, based on the last token of the pointer or the file name
+func (r *refResolver) modelName(file string, tokens []string) string {
+	base := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if len(tokens) > 0 {
+		base = tokens[len(tokens)-1]
+	}
+
+	// Names end up in refs, so can't have slashes
+	base = strings.ReplaceAll(base, "/", "_")
+
+	name := base
+	for i := 2; ; i++ {
+		_, isModel := r.models[name]
+		_, isHoisted := r.hoisted[name]
+
+		if !isModel && !isHoisted {
+			return name
+		}
+
+		name = fmt.Sprintf("%s%d", base, i)
+	}
+}
+
+// Split a ref into the absolute path of the file & the JSON pointer
+func (r *refResolver) split(ref, file string) (string, string, error) {
+	refFile, fragment, _ := strings.Cut(ref, "#")
+
+	if strings.Contains(refFile, "://") {
+		return "", "", fmt.Errorf("remote $ref '%s' is not supported, only local files", ref)
+	}
+
+	targetFile := file
+	if refFile != "" {
+		targetFile = refFile
+		if !filepath.IsAbs(refFile) {
+			targetFile = filepath.Join(filepath.Dir(file), refFile)
+		}
+	}
+
+	pointer, err := url.PathUnescape(fragment)
+	if err != nil {
+		pointer = fragment
+	}
+
+	return filepath.Clean(targetFile), pointer, nil
+}
+
+// Find the value a ref points to, loading the file if needed
+func (r *refResolver) target(file, pointer string) (any, bool, error) {
+	doc, err := r.load(file)
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to load $ref file: %w", err)
+	}
+
+	val, found := resolvePointer(doc, pointer)
+
+	return val, found, nil
+}
+
+// Split a JSON pointer into its unescaped tokens
+func pointerTokens(pointer string) []string {
+	if pointer == "" || pointer == "/" {
+		return nil
+	}
+
+	tokens := strings.Split(strings.TrimPrefix(pointer, "/"), "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+
+	return tokens
+}
+
+// Get a value from nested maps by a list of keys
+func getPath(node any, path []string) any {
+	for _, key := range path {
+		m, isMap := node.(map[string]any)
+		if !isMap {
+			return nil
+		}
+
+		node = m[key]
+	}
+
+	return node
+}
+
+// Get a map from nested maps by a list of keys, creating any that are missing
+func ensurePath(node map[string]any, path []string) map[string]any {
+	for _, key := range path {
+		child, isMap := node[key].(map[string]any)
+		if !isMap {
+			child = map[string]any{}
+			node[key] = child
+		}
+
+		node = child
+	}
+
+	return node
+}
+
+func isYAMLFile(filePath string) bool {
+	return strings.HasSuffix(filePath, ".yaml") || strings.HasSuffix(filePath, ".yml")
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Write a set of files into a temp directory, returning the directory
+func writeSpecFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func TestRefResolution(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"openapi.yaml": `
+openapi: "3.0.3"
+info:
+  title: Multi file
+  version: 1.0.0
+paths:
+  /orders:
+    get:
+      parameters:
+        - $ref: "./params.yaml#/limit"
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: "./models/order.yaml#/Order"
+        "404":
+          $ref: "#/components/responses/NotFound"
+        "500":
+          description: Error
+          content:
+            application/json:
+              schema:
+                $ref: "common.json#/definitions/Error"
+  /owners:
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/Pet/properties/owner"
+  /slashed:
+    get:
+      responses:
+        "200":
+          description: OK
+          content:
+            application/json:
+              schema:
+                $ref: "#/components/schemas/a~1b"
+components:
+  responses:
+    NotFound:
+      description: Not found
+      content:
+        application/json:
+          schema:
+            $ref: "#/components/schemas/Error"
+  schemas:
+    Error:
+      type: object
+      properties:
+        message:
+          type: string
+          example: local error
+    Pet:
+      type: object
+      properties:
+        owner:
+          type: object
+          properties:
+            name:
+              type: string
+              example: Alice
+    a/b:
+      type: string
+      example: slashed
+`,
+		"params.yaml": `
+limit:
+  name: limit
+  in: query
+  schema:
+    type: integer
+`,
+		"models/order.yaml": `
+Order:
+  type: object
+  properties:
+    id:
+      type: string
+      example: ord-1
+    items:
+      type: array
+      items:
+        $ref: "./item.yaml"
+    related:
+      type: array
+      items:
+        $ref: "#/Order"
+`,
+		"models/item.yaml": `
+type: object
+properties:
+  sku:
+    type: string
+    example: abc
+`,
+		"common.json": `{
+  "definitions": {
+    "Error": {
+      "type": "object",
+      "properties": { "code": { "type": "integer", "example": 500 } }
+    }
+  }
+}`,
+	})
+
+	specV2, err := ParseSpec(filepath.Join(dir, "openapi.yaml"))
+	if err != nil {
+		t.Fatalf("failed to parse spec, got: %v", err)
+	}
+
+	op := specV2.Paths["/orders"].Get
+
+	t.Run("file_refs", func(t *testing.T) {
+		if _, exists := specV2.Definitions["Order"]; !exists {
+			t.Fatalf("expected Order model copied from other file, got: %v", sortedKeys(specV2.Definitions))
+		}
+
+		payload := op.Responses["200"].parse(specV2.Definitions)
+		order, isMap := payload.(map[string]any)
+		if !isMap || order["id"] != "ord-1" {
+			t.Fatalf("expected order payload, got: %v", payload)
+		}
+
+		items, _ := order["items"].([]any)
+		if len(items) != 1 || items[0].(map[string]any)["sku"] != "abc" {
+			t.Errorf("expected item from relative ref in models dir, got: %v", order["items"])
+		}
+	})
+
+	t.Run("name_clash", func(t *testing.T) {
+		errModel := op.Responses["500"].Schema
+		if errModel.Ref != "#/components/schemas/Error2" {
+			t.Errorf("expected ref to Error2 as Error is taken, got: %s", errModel.Ref)
+		}
+
+		if payload, _ := op.Responses["500"].parse(specV2.Definitions).(map[string]any); !equalValues(payload["code"], 500) {
+			t.Errorf("expected error from common.json, got: %v", payload)
+		}
+	})
+
+	t.Run("parameter", func(t *testing.T) {
+		if len(op.Parameters) != 1 || op.Parameters[0].Name != "limit" || !op.Parameters[0].Schema.Type.is("integer") {
+			t.Errorf("expected limit parameter from other file, got: %v", op.Parameters)
+		}
+	})
+
+	t.Run("response", func(t *testing.T) {
+		payload, _ := op.Responses["404"].parse(specV2.Definitions).(map[string]any)
+		if op.Responses["404"].Description != "Not found" || payload["message"] != "local error" {
+			t.Errorf("expected NotFound response resolved, got: %v %v", op.Responses["404"], payload)
+		}
+	})
+
+	t.Run("pointer", func(t *testing.T) {
+		payload, _ := specV2.Paths["/owners"].Get.Responses["200"].parse(specV2.Definitions).(map[string]any)
+		if payload["name"] != "Alice" {
+			t.Errorf("expected owner from nested pointer, got: %v", payload)
+		}
+
+		if payload := specV2.Paths["/slashed"].Get.Responses["200"].parse(specV2.Definitions); payload != "slashed" {
+			t.Errorf("expected model with escaped slash, got: %v", payload)
+		}
+	})
+
+	t.Run("circular_inline", func(t *testing.T) {
+		dir := writeSpecFiles(t, map[string]string{
+			"spec.yaml": `
+swagger: "2.0"
+info:
+  title: Circular
+  version: 1.0.0
+paths:
+  /things:
+    get:
+      parameters:
+        - $ref: "#/parameters/A"
+      responses:
+        "200":
+          description: OK
+parameters:
+  A:
+    $ref: "#/parameters/B"
+  B:
+    $ref: "#/parameters/A"
+`,
+		})
+
+		_, err := ParseSpec(filepath.Join(dir, "spec.yaml"))
+		if err == nil || !strings.Contains(err.Error(), "circular") {
+			t.Errorf("expected circular ref error, got: %v", err)
+		}
+	})
+
+	t.Run("missing_file", func(t *testing.T) {
+		dir := writeSpecFiles(t, map[string]string{
+			"spec.json": `{ "swagger": "2.0", "info": { "title": "x", "version": "1" }, "paths": { "/x": { "get": {
+				"responses": { "200": { "description": "OK", "schema": { "$ref": "nope.json#/Thing" } } }
+			} } } }`,
+		})
+
+		if _, err := ParseSpec(filepath.Join(dir, "spec.json")); err == nil {
+			t.Error("expected error for missing file")
+		}
+
+		issues, err := lintSpec(filepath.Join(dir, "spec.json"))
+		if err != nil || len(issues) != 1 || !strings.Contains(issues[0].message, "can not be loaded") {
+			t.Errorf("expected lint issue for missing file, got: %v %v", issues, err)
+		}
+	})
+
+	t.Run("v2_examples_literal", func(t *testing.T) {
+		dir := writeSpecFiles(t, map[string]string{
+			"spec.yaml": `
+swagger: "2.0"
+info: { title: x, version: "1" }
+paths:
+  /refs:
+    get:
+      responses:
+        "200":
+          description: OK
+          examples:
+            application/json: { "$ref": "#/definitions/Missing", "name": "Rex" }
+`,
+		})
+
+		root, err := resolveSpec(filepath.Join(dir, "spec.yaml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		examples := getPath(root, []string{"paths", "/refs", "get", "responses", "200", "examples", "application/json"})
+		if example, _ := examples.(map[string]any); example["$ref"] != "#/definitions/Missing" || example["name"] != "Rex" {
+			t.Errorf("expected example to be left as it is, got: %v", examples)
+		}
+	})
+}
@@ -0,0 +1,496 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Stateful mode, resources are stored so they can be created & fetched
+// ----------------------------------------------------------------------------
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// A collection of resources inferred from the shape of the paths in a spec,
+// e.g. /pets is the collection & /pets/{petId} is an item in it
+type resource struct {
+	collectionPath string
+	itemPath       string
+	idParam        string
+}
+
+// Resources stored by the request path of their collection, so nested collections
+// such as /owners/1/pets & /owners/2/pets are kept apart
+type resourceStore struct {
+	lock        sync.Mutex
+	collections map[string]*resourceCollection
+	backend     storageBackend
+
+	// Items to start collections with, used instead of the examples in the spec
+	fixtures map[string][]any
+}
+
+// Which collection in the store to use, with how to find the id of an item &
+// the items to start with, which are only used the first time it's used
+type collectionRef struct {
+	key     string
+	idParam string
+	seed    func() []any
+}
+
+// Items in a collection, the order they were added is kept for listing them
+type resourceCollection struct {
+	IDs   []string       `json:"ids"`
+	Items map[string]any `json:"items"`
+}
+
+// Matches a path segment which is only a parameter, e.g. {petId}
+var paramSegmentRegex = regexp.MustCompile(`^{([^}]+)}$`)
+
+// Shared by all APIs, so state is kept when the specs are reloaded
+var store = newResourceStore(memoryBackend{})
+
+func newResourceStore(backend storageBackend) *resourceStore {
+	return &resourceStore{collections: map[string]*resourceCollection{}, backend: backend}
+}
+
+// Load the collections kept by the backend
+func (s *resourceStore) load() error {
+	collections, err := s.backend.load()
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.collections = collections
+
+	return nil
+}
+
+// Remove all resources, collections are seeded again when next used
+func (s *resourceStore) reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.collections = map[string]*resourceCollection{}
+	s.save()
+}
+
+// Save all the collections after a change, a failure is logged as the change is still made in memory
+// The lock must be held when calling this
+func (s *resourceStore) save() {
+	if err := s.backend.save(s.collections); err != nil {
+		logger.Error("Failed to save resources", slog.Any("error", err))
+	}
+}
+
+// Find the resource a path is part of, returns nil if it isn't a collection or an item
+func findResource(paths map[string]PathSpec, path string) *resource {
+	parent, param := splitItemPath(path)
+	if param != "" {
+		return &resource{collectionPath: parent, itemPath: path, idParam: param}
+	}
+
+	for _, other := range sortedKeys(paths) {
+		if otherParent, param := splitItemPath(other); param != "" && otherParent == path {
+			return &resource{collectionPath: path, itemPath: other, idParam: param}
+		}
+	}
+
+	return nil
+}
+
+// Split a path ending in a parameter into the parent path & the name of the parameter
+func splitItemPath(path string) (string, string) {
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return "", ""
+	}
+
+	match := paramSegmentRegex.FindStringSubmatch(path[i+1:])
+	if match == nil {
+		return "", ""
+	}
+
+	if path[:i] == "" {
+		return "/", match[1]
+	}
+
+	return path[:i], match[1]
+}
+
+// Handle a request to a resource using the store, returns false if the method is
+// not one which changes or fetches resources, so the spec should be used instead
+func (res *resource) handle(w http.ResponseWriter, r *http.Request, route mockRoute) bool {
+	isItem := route.path == res.itemPath
+
+	// The key of the collection is the request path, without the id for items
+	collectionKey := strings.TrimSuffix(r.URL.Path, "/")
+	if isItem {
+		collectionKey = collectionKey[:strings.LastIndex(collectionKey, "/")]
+	}
+
+	coll := collectionRef{collectionKey, res.idParam, func() []any { return res.seed(route.api) }}
+	id := ""
+
+	if isItem {
+		id = chi.URLParam(r, res.idParam)
+	}
+
+	switch {
+	case !isItem && r.Method == http.MethodGet:
+		writeResource(w, r, route, http.StatusOK, store.list(coll))
+
+	case !isItem && r.Method == http.MethodPost:
+		body, ok := readResource(w, r)
+		if !ok {
+			return true
+		}
+
+		writeResource(w, r, route, http.StatusCreated, store.create(coll, body))
+
+	case isItem && r.Method == http.MethodGet:
+		item, found := store.get(coll, id)
+		if !found {
+			res.notFound(w, r)
+			return true
+		}
+
+		writeResource(w, r, route, http.StatusOK, item)
+
+	case isItem && (r.Method == http.MethodPut || r.Method == http.MethodPatch):
+		body, ok := readResource(w, r)
+		if !ok {
+			return true
+		}
+
+		item, found := store.update(coll, id, body, r.Method == http.MethodPatch)
+		if !found {
+			res.notFound(w, r)
+			return true
+		}
+
+		writeResource(w, r, route, http.StatusOK, item)
+
+	case isItem && r.Method == http.MethodDelete:
+		item, found := store.remove(coll, id)
+		if !found {
+			res.notFound(w, r)
+			return true
+		}
+
+		writeResource(w, r, route, http.StatusNoContent, item)
+
+	default:
+		return false
+	}
+
+	return true
+}
+
+// Starting data for a collection, from the examples of the collection GET, or failing that the item GET
+// Fixtures for the collection are used instead of this when there are any
+func (res *resource) seed(api *mockAPI) []any {
+	for _, path := range []string{res.collectionPath, res.itemPath} {
+		op, exists := api.spec.Paths[path].operations()[http.MethodGet]
+		if !exists {
+			continue
+		}
+
+		respIndex, _ := op.pickResponse(http.StatusOK, false)
+
+		switch payload := op.Responses[respIndex].parse(api.spec.Definitions).(type) {
+		case []any:
+			return payload
+		case map[string]any:
+			if path == res.itemPath {
+				return []any{payload}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (res *resource) notFound(w http.ResponseWriter, r *http.Request) {
+	logger.Warn("Resource not found", slog.Any("path", r.URL.Path))
+	writeProblem(w, r, http.StatusNotFound, "Resource not found",
+		[]violation{{"path", res.idParam, "", "does not exist"}})
+}
+
+// Read a JSON object from the request body, a problem is sent if it isn't one
+func readResource(w http.ResponseWriter, r *http.Request) (map[string]any, bool) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeProblem(w, r, http.StatusBadRequest, "Request body could not be read", nil)
+		return nil, false
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal(data, &body); err != nil || body == nil {
+		writeProblem(w, r, http.StatusBadRequest, "Request body must be a JSON object",
+			[]violation{{"body", "body", "", "must be a JSON object"}})
+
+		return nil, false
+	}
+
+	return body, true
+}
+
+// Send a resource using the response of the operation, so media types & headers are as per the spec
+func writeResource(w http.ResponseWriter, r *http.Request, route mockRoute, preferred int, payload any) {
+	respIndex, statusCode := strconv.Itoa(preferred), preferred
+	if _, exists := route.op.Responses[respIndex]; !exists {
+		respIndex, statusCode = route.op.pickResponse(http.StatusOK, false)
+	}
+
+	resp := route.op.Responses[respIndex]
+
+	gen := newGenerator(route.api.spec.Definitions)
+	for name, val := range resp.headerValues(gen, r.URL.Path, payload) {
+		w.Header().Set(name, val)
+	}
+
+	// Nothing to send back, e.g. a 204 after a delete
+	if statusCode == http.StatusNoContent || (resp.Schema.isEmpty() && r.Method == http.MethodDelete) {
+		w.WriteHeader(statusCode)
+		return
+	}
+
+	mediaType, acceptable := negotiate(r.Header.Get("Accept"), route.op.producesFor(resp, route.api.spec.Produces))
+	if !acceptable {
+		w.WriteHeader(http.StatusNotAcceptable)
+		return
+	}
+
+	body, err := encodePayload(mediaType, payload, resp.Schema, route.api.spec.Definitions)
+	if err != nil {
+		logger.Error("Failed to encode payload", slog.Any("mediaType", mediaType), slog.Any("error", err))
+		w.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(statusCode)
+	_, _ = w.Write(body)
+}
+
+// Get a collection, seeding it the first time it's used
+// The lock must be held when calling this
+func (s *resourceStore) collection(ref collectionRef) *resourceCollection {
+	coll, exists := s.collections[ref.key]
+	if exists {
+		return coll
+	}
+
+	coll = &resourceCollection{Items: map[string]any{}}
+	s.collections[ref.key] = coll
+
+	seed, hasFixtures := s.fixtures[ref.key]
+	if !hasFixtures {
+		seed = ref.seed()
+	}
+
+	for _, item := range seed {
+		obj, isMap := item.(map[string]any)
+		if !isMap {
+			continue
+		}
+
+		if id, hasID := idOf(obj, ref.idParam); hasID {
+			coll.put(id, obj)
+		}
+	}
+
+	logger.Debug("Seeded collection", slog.Any("collection", ref.key), slog.Any("items", len(coll.IDs)))
+
+	return coll
+}
+
+// All the items in a collection, in the order they were added
+func (s *resourceStore) list(ref collectionRef) []any {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	coll := s.collection(ref)
+
+	items := make([]any, 0, len(coll.IDs))
+	for _, id := range coll.IDs {
+		items = append(items, coll.Items[id])
+	}
+
+	return items
+}
+
+func (s *resourceStore) get(ref collectionRef, id string) (any, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	item, found := s.collection(ref).Items[id]
+
+	return item, found
+}
+
+// Add an item, the id is taken from the item or a new one is picked
+func (s *resourceStore) create(ref collectionRef, item map[string]any) any {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	coll := s.collection(ref)
+
+	id, hasID := idOf(item, ref.idParam)
+	if !hasID {
+		newID := coll.nextID()
+		item[idField(item, ref.idParam)] = newID
+		id = fmt.Sprint(newID)
+	}
+
+	coll.put(id, item)
+	s.save()
+
+	return item
+}
+
+// Replace an item, or merge into it for a patch, the id can't be changed
+func (s *resourceStore) update(ref collectionRef, id string, item map[string]any, patch bool) (any, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	coll := s.collection(ref)
+
+	existing, found := coll.Items[id]
+	if !found {
+		return nil, false
+	}
+
+	existingObj, _ := existing.(map[string]any)
+	field := idField(existingObj, ref.idParam)
+
+	if patch {
+		item, _ = mergePatch(existingObj, item).(map[string]any)
+	}
+
+	item[field] = existingObj[field]
+	coll.put(id, item)
+	s.save()
+
+	return item, true
+}
+
+func (s *resourceStore) remove(ref collectionRef, id string) (any, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	coll := s.collection(ref)
+
+	item, found := coll.Items[id]
+	if !found {
+		return nil, false
+	}
+
+	delete(coll.Items, id)
+
+	for i, other := range coll.IDs {
+		if other == id {
+			coll.IDs = append(coll.IDs[:i], coll.IDs[i+1:]...)
+			break
+		}
+	}
+
+	s.save()
+
+	return item, true
+}
+
+func (c *resourceCollection) put(id string, item any) {
+	if _, exists := c.Items[id]; !exists {
+		c.IDs = append(c.IDs, id)
+	}
+
+	c.Items[id] = item
+}
+
+// Pick an id for a new item, numbers follow on from the highest id, otherwise a UUID is used
+func (c *resourceCollection) nextID() any {
+	highest := 0
+
+	for _, id := range c.IDs {
+		num, err := strconv.Atoi(id)
+		if err != nil {
+			return newUUID()
+		}
+
+		highest = max(highest, num)
+	}
+
+	return highest + 1
+}
+
+// Random v4 UUID, not from the fake data generator as that gives the same one for the same seed
+func newUUID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// The property holding the id of an item, the name of the path parameter or `id`
+func idField(item map[string]any, idParam string) string {
+	if _, exists := item[idParam]; exists && idParam != "" {
+		return idParam
+	}
+
+	return "id"
+}
+
+func idOf(item map[string]any, idParam string) (string, bool) {
+	id, exists := item[idField(item, idParam)]
+	if !exists || id == nil {
+		return "", false
+	}
+
+	return fmt.Sprint(id), true
+}
+
+// Apply a JSON merge patch (RFC 7396), nulls remove properties & objects are merged
+func mergePatch(target, patch any) any {
+	patchObj, isMap := patch.(map[string]any)
+	if !isMap {
+		return patch
+	}
+
+	targetObj, isMap := target.(map[string]any)
+	if !isMap {
+		targetObj = map[string]any{}
+	}
+
+	merged := make(map[string]any, len(targetObj))
+	for key, val := range targetObj {
+		merged[key] = val
+	}
+
+	for key, val := range patchObj {
+		if val == nil {
+			delete(merged, key)
+			continue
+		}
+
+		merged[key] = mergePatch(merged[key], val)
+	}
+
+	return merged
+}
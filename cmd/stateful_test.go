@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStateful(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"spec.yaml": `
+swagger: "2.0"
+info:
+  title: Stateful
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        "200":
+          description: OK
+          schema:
+            type: array
+            items:
+              $ref: "#/definitions/Pet"
+          examples:
+            application/json: [{ "petId": "a", "name": "Seed" }]
+    post:
+      responses:
+        "201":
+          description: Created
+          schema:
+            $ref: "#/definitions/Pet"
+  /pets/{petId}:
+    get:
+      responses:
+        "200":
+          description: OK
+          schema:
+            $ref: "#/definitions/Pet"
+    put:
+      responses:
+        "200":
+          description: OK
+    patch:
+      responses:
+        "200":
+          description: OK
+    delete:
+      responses:
+        "204":
+          description: Deleted
+  /owners/{ownerId}/toys:
+    post:
+      responses:
+        "201":
+          description: Created
+    get:
+      responses:
+        "200":
+          description: OK
+  /owners/{ownerId}/toys/{toyId}:
+    get:
+      responses:
+        "200":
+          description: OK
+definitions:
+  Pet:
+    type: object
+    properties:
+      petId:
+        type: string
+      name:
+        type: string
+`,
+	})
+
+	config.stateful = true
+	store = newResourceStore(memoryBackend{})
+
+	defer func() {
+		config.stateful = false
+		store = newResourceStore(memoryBackend{})
+	}()
+
+	apis, err := loadAPIs([]string{filepath.Join(dir, "spec.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router, err := newRouter(apis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, target, body string) (int, string) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+
+	steps := []struct {
+		name     string
+		method   string
+		target   string
+		body     string
+		status   int
+		expected string
+	}{
+		{"seeded", http.MethodGet, "/pets", "", 200, `[{"name":"Seed","petId":"a"}]`},
+		{"create", http.MethodPost, "/pets", `{"petId":"b","name":"Rex"}`, 201, `{"name":"Rex","petId":"b"}`},
+		{"fetch", http.MethodGet, "/pets/b", "", 200, `{"name":"Rex","petId":"b"}`},
+		{"list", http.MethodGet, "/pets", "", 200, `[{"name":"Seed","petId":"a"},{"name":"Rex","petId":"b"}]`},
+		{"replace", http.MethodPut, "/pets/b", `{"name":"Max","petId":"z"}`, 200, `{"name":"Max","petId":"b"}`},
+		{"patch", http.MethodPatch, "/pets/b", `{"name":null,"age":3}`, 200, `{"age":3,"petId":"b"}`},
+		{"delete", http.MethodDelete, "/pets/b", "", 204, ``},
+		{"deleted", http.MethodGet, "/pets/b", "", 404, ``},
+		{"unknown_put", http.MethodPut, "/pets/nope", `{}`, 404, ``},
+		{"not_object", http.MethodPost, "/pets", `[1]`, 400, ``},
+		{"new_id", http.MethodPost, "/owners/1/toys", `{"name":"Ball"}`, 201, `{"id":1,"name":"Ball"}`},
+		{"nested", http.MethodGet, "/owners/2/toys", "", 200, `[]`},
+	}
+
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			status, body := send(step.method, step.target, step.body)
+			if status != step.status {
+				t.Fatalf("expected status %d, got: %d %s", step.status, status, body)
+			}
+
+			if step.expected != "" && body != step.expected {
+				t.Errorf("expected %s, got: %s", step.expected, body)
+			}
+		})
+	}
+
+	t.Run("problem", func(t *testing.T) {
+		_, body := send(http.MethodGet, "/pets/nope", "")
+
+		var prob problem
+		if err := json.Unmarshal([]byte(body), &prob); err != nil || len(prob.Errors) != 1 || prob.Errors[0].Name != "petId" {
+			t.Errorf("expected problem details for unknown id, got: %s", body)
+		}
+	})
+	t.Run("uuid_ids", func(t *testing.T) {
+		// Ids aren't numbers, so new items get a UUID each
+		send(http.MethodPost, "/pets", `{"name":"Rex"}`)
+		send(http.MethodPost, "/pets", `{"name":"Fido"}`)
+
+		_, body := send(http.MethodGet, "/pets", "")
+
+		var pets []map[string]any
+		if err := json.Unmarshal([]byte(body), &pets); err != nil || len(pets) != 3 {
+			t.Fatalf("expected both new pets to be kept, got: %s", body)
+		}
+
+		if pets[1]["id"] == pets[2]["id"] || len(fmt.Sprint(pets[1]["id"])) != 36 {
+			t.Errorf("expected different UUIDs, got: %v & %v", pets[1]["id"], pets[2]["id"])
+		}
+	})
+}
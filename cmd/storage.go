@@ -0,0 +1,136 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Storage backends for stateful mode & loading fixtures
+// ----------------------------------------------------------------------------
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Where the resources of stateful mode are kept, so they can outlive the process
+// The store holds everything in memory, and saves to the backend after every change
+type storageBackend interface {
+	load() (map[string]*resourceCollection, error)
+	save(collections map[string]*resourceCollection) error
+}
+
+// Keeps nothing, resources are lost when mockery stops
+type memoryBackend struct{}
+
+// Keeps all the collections in a single JSON file
+type fileBackend struct {
+	path string
+}
+
+func (memoryBackend) load() (map[string]*resourceCollection, error) {
+	return map[string]*resourceCollection{}, nil
+}
+
+func (memoryBackend) save(map[string]*resourceCollection) error {
+	return nil
+}
+
+// A missing file is fine, it's created on the first change
+func (b fileBackend) load() (map[string]*resourceCollection, error) {
+	collections := map[string]*resourceCollection{}
+
+	data, err := os.ReadFile(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return collections, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &collections); err != nil {
+		return nil, fmt.Errorf("store file %s is not valid: %w", b.path, err)
+	}
+
+	for _, coll := range collections {
+		if coll.Items == nil {
+			coll.Items = map[string]any{}
+		}
+	}
+
+	return collections, nil
+}
+
+// Written to a temp file then renamed, so the file is never left half written
+func (b fileBackend) save(collections map[string]*resourceCollection) error {
+	data, err := json.MarshalIndent(collections, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tempPath := b.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0o600); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, b.path)
+}
+
+// Set up the store for stateful mode from the config
+func setupStore() error {
+	var backend storageBackend = memoryBackend{}
+	if config.storeFile != "" {
+		backend = fileBackend{path: config.storeFile}
+	}
+
+	store = newResourceStore(backend)
+	if err := store.load(); err != nil {
+		return err
+	}
+
+	if config.fixtures != "" {
+		return store.loadFixtures(config.fixtures)
+	}
+
+	return nil
+}
+
+// Load every JSON & YAML file in a directory, each is a map of collection paths to lists of items
+// Files are loaded in name order, and items for the same collection are added together
+func (s *resourceStore) loadFixtures(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("unable to read fixtures: %w", err)
+	}
+
+	fixtures := map[string][]any{}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(isYAMLFile(name) || strings.HasSuffix(name, ".json")) {
+			continue
+		}
+
+		fileFixtures := map[string][]any{}
+		if err := loadSpecFile(filepath.Join(dir, name), &fileFixtures); err != nil {
+			return fmt.Errorf("fixtures file %s is not valid: %w", name, err)
+		}
+
+		for key, items := range fileFixtures {
+			key = strings.TrimSuffix(key, "/")
+			fixtures[key] = append(fixtures[key], items...)
+		}
+	}
+
+	logger.Info("Loaded fixtures", slog.Any("dir", dir), slog.Any("collections", sortedKeys(fixtures)))
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.fixtures = fixtures
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestStorage(t *testing.T) {
+	seed := func() []any {
+		return []any{map[string]any{"id": 1, "name": "From spec"}}
+	}
+
+	pets := collectionRef{"/pets", "petId", seed}
+
+	t.Run("file_backend", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "store.json")
+
+		first := newResourceStore(fileBackend{path: path})
+		if err := first.load(); err != nil {
+			t.Fatal(err)
+		}
+
+		first.create(pets, map[string]any{"name": "Rex"})
+		first.remove(pets, "1")
+
+		// A new store is like a restart, it should see the changes
+		second := newResourceStore(fileBackend{path: path})
+		if err := second.load(); err != nil {
+			t.Fatal(err)
+		}
+
+		items := second.list(pets)
+		if len(items) != 1 || items[0].(map[string]any)["name"] != "Rex" {
+			t.Errorf("expected only Rex after reload, got: %v", items)
+		}
+
+		if _, found := second.get(pets, "2"); !found {
+			t.Error("expected Rex to keep the id it was given")
+		}
+	})
+
+	t.Run("fixtures", func(t *testing.T) {
+		dir := writeSpecFiles(t, map[string]string{
+			"a.yaml":    "/pets:\n  - petId: x\n    name: Fixture\n",
+			"b.json":    `{ "/pets/": [{ "petId": "y" }], "/owners/1/pets": [{ "id": 5 }] }`,
+			"notes.txt": "not a fixture",
+		})
+
+		s := newResourceStore(memoryBackend{})
+		if err := s.loadFixtures(dir); err != nil {
+			t.Fatal(err)
+		}
+
+		if items := s.list(pets); len(items) != 2 {
+			t.Errorf("expected fixtures from both files instead of the spec, got: %v", items)
+		}
+
+		if _, found := s.get(collectionRef{"/owners/1/pets", "petId", seed}, "5"); !found {
+			t.Error("expected nested collection from fixtures")
+		}
+
+		if _, found := s.get(collectionRef{"/other", "id", seed}, "1"); !found {
+			t.Error("expected collection without fixtures to use the spec")
+		}
+	})
+
+	t.Run("invalid_file", func(t *testing.T) {
+		dir := writeSpecFiles(t, map[string]string{"store.json": "{"})
+
+		if err := newResourceStore(fileBackend{path: filepath.Join(dir, "store.json")}).load(); err == nil {
+			t.Error("expected error for invalid store file")
+		}
+	})
+}
@@ -0,0 +1,421 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Stubs added at runtime with the admin API, which override the spec
+// ----------------------------------------------------------------------------
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Header which scopes a request to a test session, so stubs for one test don't affect another
+const sessionHeader = "x-mock-session"
+
+// A stub returns a fixed response for requests that match it, instead of the spec
+type stub struct {
+	ID       string         `json:"id"`
+	Session  string         `json:"session,omitempty"`
+	Request  requestPattern `json:"request"`
+	Response stubResponse   `json:"response"`
+}
+
+// What a request must have to match, anything left empty matches all requests
+// Used by stubs, and to find requests in the journal
+type requestPattern struct {
+	Method      string            `json:"method,omitempty"`
+	Path        string            `json:"path,omitempty"`
+	PathPattern string            `json:"pathPattern,omitempty"`
+	Query       map[string]string `json:"query,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	Body        any               `json:"body,omitempty"`
+	BodyPaths   map[string]any    `json:"bodyPaths,omitempty"`
+
+	pathRegex *regexp.Regexp
+}
+
+type stubResponse struct {
+	Status  int               `json:"status,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    any               `json:"body,omitempty"`
+	Delay   int               `json:"delay,omitempty"`
+}
+
+// All the stubs, newest last, the newest matching stub is used
+type stubRegistry struct {
+	lock   sync.RWMutex
+	stubs  []*stub
+	lastID int
+}
+
+// Shared by all APIs, so stubs are kept when the specs are reloaded
+var stubs = &stubRegistry{}
+
+// Check a stub can be used
+func (s *stub) prepare() error {
+	if err := s.Request.prepare(); err != nil {
+		return err
+	}
+
+	if s.Response.Status == 0 {
+		s.Response.Status = http.StatusOK
+	}
+
+	if s.Response.Status < 100 || s.Response.Status > 599 {
+		return fmt.Errorf("status %d is not between 100 & 599", s.Response.Status)
+	}
+
+	return nil
+}
+
+// Check a pattern can be used, and compile its path pattern
+func (p *requestPattern) prepare() error {
+	if p.Path != "" && p.PathPattern != "" {
+		return fmt.Errorf("only one of path or pathPattern can be set")
+	}
+
+	if p.PathPattern != "" {
+		regex, err := regexp.Compile(p.PathPattern)
+		if err != nil {
+			return fmt.Errorf("pathPattern is not a valid regular expression: %w", err)
+		}
+
+		p.pathRegex = regex
+	}
+
+	for path := range p.BodyPaths {
+		if !strings.HasPrefix(path, "$") {
+			return fmt.Errorf("body path '%s' must start with $", path)
+		}
+	}
+
+	return nil
+}
+
+// Check if a request matches, the body is only needed when the pattern checks it
+func (p *requestPattern) matches(method, path string, query url.Values, headers http.Header, body []byte) bool {
+	if p.Method != "" && !strings.EqualFold(p.Method, method) {
+		return false
+	}
+
+	if p.Path != "" && p.Path != path {
+		return false
+	}
+
+	if p.pathRegex != nil && !p.pathRegex.MatchString(path) {
+		return false
+	}
+
+	for name, val := range p.Query {
+		if !containsString(query[name], val) {
+			return false
+		}
+	}
+
+	for name, val := range p.Headers {
+		if !containsString(headers.Values(name), val) {
+			return false
+		}
+	}
+
+	if !p.needsBody() {
+		return true
+	}
+
+	var bodyVal any
+	if err := json.Unmarshal(body, &bodyVal); err != nil {
+		// Not JSON, so it can only match a string body
+		bodyString, isString := p.Body.(string)
+		return isString && len(p.BodyPaths) == 0 && bodyString == string(body)
+	}
+
+	if p.Body != nil && !equalValues(p.Body, bodyVal) {
+		return false
+	}
+
+	for path, expected := range p.BodyPaths {
+		val, found := jsonPathValue(bodyVal, path)
+		if !found || !equalValues(val, expected) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (p *requestPattern) needsBody() bool {
+	return p.Body != nil || len(p.BodyPaths) > 0
+}
+
+// Send the response of the stub, after the delay if there is one
+func (s *stub) respond(w http.ResponseWriter, r *http.Request) {
+	if s.Response.Delay > 0 {
+		select {
+		case <-time.After(time.Duration(s.Response.Delay) * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	for name, val := range s.Response.Headers {
+		w.Header().Set(name, val)
+	}
+
+	if s.Response.Body == nil {
+		w.WriteHeader(s.Response.Status)
+		return
+	}
+
+	// Strings are sent as they are, anything else is sent as JSON
+	body, isString := s.Response.Body.(string)
+	if !isString {
+		data, _ := json.Marshal(s.Response.Body)
+		body = string(data)
+
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", contentType)
+		}
+	}
+
+	w.WriteHeader(s.Response.Status)
+	_, _ = w.Write([]byte(body))
+}
+
+// Add a stub, giving it a new id
+func (reg *stubRegistry) add(s *stub) {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+
+	reg.lastID++
+	s.ID = strconv.Itoa(reg.lastID)
+	reg.stubs = append(reg.stubs, s)
+}
+
+// Stubs for a session, or all stubs if the session is empty
+func (reg *stubRegistry) list(session string) []*stub {
+	reg.lock.RLock()
+	defer reg.lock.RUnlock()
+
+	list := []*stub{}
+
+	for _, s := range reg.stubs {
+		if session == "" || s.Session == session {
+			list = append(list, s)
+		}
+	}
+
+	return list
+}
+
+func (reg *stubRegistry) remove(id string) bool {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+
+	for i, s := range reg.stubs {
+		if s.ID == id {
+			reg.stubs = append(reg.stubs[:i], reg.stubs[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Remove the stubs for a session, or all stubs if the session is empty
+func (reg *stubRegistry) clear(session string) {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+
+	kept := []*stub{}
+
+	for _, s := range reg.stubs {
+		if session != "" && s.Session != session {
+			kept = append(kept, s)
+		}
+	}
+
+	reg.stubs = kept
+}
+
+// Find the stub for a request, stubs for the session of the request come first,
+// then those without a session, the newest stub wins in each
+func (reg *stubRegistry) find(r *http.Request) *stub {
+	// Read before taking the lock, so a slow client can't hold up changes to the stubs
+	var body []byte
+	if r.Body != nil {
+		body, _ = io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	reg.lock.RLock()
+	defer reg.lock.RUnlock()
+
+	session := r.Header.Get(sessionHeader)
+	query := r.URL.Query()
+
+	for _, wantSession := range []string{session, ""} {
+		for i := len(reg.stubs) - 1; i >= 0; i-- {
+			s := reg.stubs[i]
+			if s.Session == wantSession && s.Request.matches(r.Method, r.URL.Path, query, r.Header, body) {
+				return s
+			}
+		}
+
+		if session == "" {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Middleware which sends the response of a matching stub, so stubs take priority over the spec
+// The API key is still checked, and the admin API is never stubbed
+func serveStubs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, adminPrefix+"/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		s := stubs.find(r)
+		if s == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		logger.Info("Request matched stub", slog.Any("method", r.Method), slog.Any("path", r.URL.Path),
+			slog.Any("stub", s.ID))
+
+		if e := journalEntryFor(r); e != nil {
+			e.Stub = s.ID
+		}
+
+		checkAPIKey(http.HandlerFunc(s.respond)).ServeHTTP(w, r)
+	})
+}
+
+// Admin routes for adding, listing & removing stubs
+func stubRoutes(router chi.Router) {
+	router.Post("/", func(w http.ResponseWriter, r *http.Request) {
+		s := &stub{}
+		if err := json.NewDecoder(r.Body).Decode(s); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, "Stub is not valid JSON: "+err.Error(), nil)
+			return
+		}
+
+		if err := s.prepare(); err != nil {
+			writeProblem(w, r, http.StatusBadRequest, "Stub is not valid: "+err.Error(), nil)
+			return
+		}
+
+		stubs.add(s)
+		logger.Info("Added stub", slog.Any("id", s.ID), slog.Any("session", s.Session))
+
+		writeJSON(w, http.StatusCreated, s)
+	})
+
+	router.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, stubs.list(r.URL.Query().Get("session")))
+	})
+
+	router.Delete("/", func(w http.ResponseWriter, r *http.Request) {
+		stubs.clear(r.URL.Query().Get("session"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	router.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if !stubs.remove(chi.URLParam(r, "id")) {
+			writeProblem(w, r, http.StatusNotFound, "No stub with id "+chi.URLParam(r, "id"), nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Get a value from a document with a simple JSONPath, e.g. $.items[0].name or $['a b']
+// Only child names & array indexes are supported, not wildcards, slices or filters
+func jsonPathValue(doc any, path string) (any, bool) {
+	rest := strings.TrimPrefix(path, "$")
+	node := doc
+
+	for rest != "" {
+		var key string
+
+		switch {
+		case strings.HasPrefix(rest, "."):
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+
+			key, rest = rest[1:end+1], rest[end+1:]
+
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end < 0 {
+				return nil, false
+			}
+
+			key, rest = rest[2:end], rest[end+2:]
+
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, false
+			}
+
+			index, err := strconv.Atoi(rest[1:end])
+			arr, isArray := node.([]any)
+
+			if err != nil || !isArray || index < 0 || index >= len(arr) {
+				return nil, false
+			}
+
+			node, rest = arr[index], rest[end+1:]
+
+			continue
+
+		default:
+			return nil, false
+		}
+
+		obj, isMap := node.(map[string]any)
+		if !isMap {
+			return nil, false
+		}
+
+		val, exists := obj[key]
+		if !exists {
+			return nil, false
+		}
+
+		node = val
+	}
+
+	return node, true
+}
+
+func containsString(values []string, val string) bool {
+	for _, v := range values {
+		if v == val {
+			return true
+		}
+	}
+
+	return false
+}
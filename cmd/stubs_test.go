@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStubs(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"spec.yaml": `
+swagger: "2.0"
+info:
+  title: Stubbed
+  version: 1.0.0
+paths:
+  /pets:
+    get:
+      responses:
+        "200":
+          description: OK
+          examples:
+            application/json: "from spec"
+    post:
+      responses:
+        "201":
+          description: Created
+          examples:
+            application/json: "from spec"
+`,
+	})
+
+	apis, err := loadAPIs([]string{filepath.Join(dir, "spec.yaml")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { stubs = &stubRegistry{} }()
+
+	router, err := newRouter(apis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, target, body string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for name, val := range headers {
+			req.Header.Set(name, val)
+		}
+
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	addStub := func(t *testing.T, body string) string {
+		rec := send(http.MethodPost, "/__mockery/stubs", body, nil)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected stub to be added, got: %d %s", rec.Code, rec.Body.String())
+		}
+
+		s := stub{}
+		_ = json.Unmarshal(rec.Body.Bytes(), &s)
+
+		return s.ID
+	}
+
+	tests := []struct {
+		name    string
+		stub    string
+		method  string
+		target  string
+		body    string
+		headers map[string]string
+		status  int
+		expect  string
+	}{
+		{"exact_path", `{"request": {"method": "GET", "path": "/pets"}, "response": {"body": "stubbed"}}`,
+			http.MethodGet, "/pets", "", nil, 200, "stubbed"},
+		{"not_in_spec", `{"request": {"pathPattern": "^/cats/[0-9]+$"}, "response": {"status": 418, "body": "cat"}}`,
+			http.MethodGet, "/cats/12", "", nil, 418, "cat"},
+		{"query_mismatch", `{"request": {"path": "/pets", "query": {"limit": "5"}}, "response": {"body": "five"}}`,
+			http.MethodGet, "/pets?limit=6", "", nil, 200, `"from spec"`},
+		{"query_and_header", `{"request": {"query": {"limit": "5"}, "headers": {"x-test": "a"}}, "response": {"body": "5"}}`,
+			http.MethodGet, "/pets?limit=5", "", map[string]string{"x-test": "a"}, 200, "5"},
+		{"body_path", `{"request": {"method": "POST", "bodyPaths": {"$.tags[1]": "good"}}, "response": {"body": {"a": 1}}}`,
+			http.MethodPost, "/pets", `{"tags": ["cat", "good"]}`, nil, 200, `{"a":1}`},
+		{"body_equal", `{"request": {"method": "POST", "body": {"name": "Rex"}}, "response": {"status": 409}}`,
+			http.MethodPost, "/pets", `{"name": "Fido"}`, nil, 201, `"from spec"`},
+		{"session", `{"session": "s1", "request": {"path": "/pets"}, "response": {"body": "s1"}}`,
+			http.MethodGet, "/pets", "", map[string]string{sessionHeader: "s1"}, 200, "s1"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stubs.clear("")
+			addStub(t, test.stub)
+
+			rec := send(test.method, test.target, test.body, test.headers)
+			if rec.Code != test.status || strings.TrimSpace(rec.Body.String()) != test.expect {
+				t.Errorf("expected %d %s, got: %d %s", test.status, test.expect, rec.Code, rec.Body.String())
+			}
+		})
+	}
+
+	t.Run("other_session", func(t *testing.T) {
+		addStub(t, `{"request": {"path": "/pets"}, "response": {"body": "stubbed"}}`)
+
+		s1, s2 := map[string]string{sessionHeader: "s1"}, map[string]string{sessionHeader: "s2"}
+
+		if body := send(http.MethodGet, "/pets", "", s1).Body.String(); body != "s1" {
+			t.Errorf("expected stub for the session to come first, got: %s", body)
+		}
+
+		if body := send(http.MethodGet, "/pets", "", s2).Body.String(); body != "stubbed" {
+			t.Errorf("expected stub without a session, got: %s", body)
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		if rec := send(http.MethodPost, "/__mockery/stubs", `{"request": {"pathPattern": "("}}`, nil); rec.Code != 400 {
+			t.Errorf("expected 400 for bad pattern, got: %d", rec.Code)
+		}
+
+		for _, status := range []string{"42", "600", "-1"} {
+			body := `{"request": {"path": "/bad"}, "response": {"status": ` + status + `}}`
+			if rec := send(http.MethodPost, "/__mockery/stubs", body, nil); rec.Code != 400 {
+				t.Errorf("expected 400 for status %s, got: %d", status, rec.Code)
+			}
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		var list []stub
+		_ = json.Unmarshal(send(http.MethodGet, "/__mockery/stubs?session=s1", "", nil).Body.Bytes(), &list)
+
+		if len(list) != 1 {
+			t.Fatalf("expected 1 stub for the session, got: %d", len(list))
+		}
+
+		if rec := send(http.MethodDelete, "/__mockery/stubs/"+list[0].ID, "", nil); rec.Code != http.StatusNoContent {
+			t.Errorf("expected stub to be deleted, got: %d", rec.Code)
+		}
+
+		if rec := send(http.MethodDelete, "/__mockery/stubs/"+list[0].ID, "", nil); rec.Code != http.StatusNotFound {
+			t.Errorf("expected 404 for deleted stub, got: %d", rec.Code)
+		}
+
+		send(http.MethodPost, "/__mockery/reset", "", nil)
+
+		if body := strings.TrimSpace(send(http.MethodGet, "/pets", "", nil).Body.String()); body != `"from spec"` {
+			t.Errorf("expected spec response after reset, got: %s", body)
+		}
+	})
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := map[string]any{"a": map[string]any{"b c": []any{1.0, map[string]any{"d": "x"}}}}
+
+	tests := map[string]any{
+		"$":               doc,
+		"$.a['b c'][0]":   1.0,
+		"$.a['b c'][1].d": "x",
+		"$.a.missing":     nil,
+		"$.a['b c'][5]":   nil,
+	}
+
+	for path, expected := range tests {
+		val, found := jsonPathValue(doc, path)
+		if expected == nil && found {
+			t.Errorf("expected %s not to be found, got: %v", path, val)
+		}
+
+		if expected != nil && (!found || !equalValues(val, expected)) {
+			t.Errorf("expected %s to be %v, got: %v", path, expected, val)
+		}
+	}
+}
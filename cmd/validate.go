@@ -0,0 +1,246 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Validation of requests against the parameters in the spec
+// ----------------------------------------------------------------------------
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// A single problem found with a request, returned as part of the problem details
+// The pointer is where in the body (or array parameter) the problem was found
+type violation struct {
+	In      string `json:"in"`
+	Name    string `json:"name"`
+	Pointer string `json:"pointer,omitempty"`
+	Detail  string `json:"detail"`
+}
+
+// RFC 7807 problem details, with the extra `errors` member listing every violation
+type problem struct {
+	Type     string      `json:"type"`
+	Title    string      `json:"title"`
+	Status   int         `json:"status"`
+	Detail   string      `json:"detail"`
+	Instance string      `json:"instance"`
+	Errors   []violation `json:"errors"`
+}
+
+// Check a request against the parameters of the operation, returning all violations
+func validateRequest(r *http.Request, params []Parameters, definitions map[string]Schema) []violation {
+	violations := []violation{}
+
+	for _, param := range params {
+		if param.In == "body" {
+			violations = append(violations, validateBody(r, param, definitions)...)
+			continue
+		}
+
+		values, present := paramValues(r, param)
+		if !present {
+			if param.Required {
+				violations = append(violations, violation{param.In, param.Name, "", "is required"})
+			}
+
+			continue
+		}
+
+		for _, err := range validateParam(param, values, definitions) {
+			violations = append(violations, violation{param.In, param.Name, err.Pointer, err.Detail})
+		}
+	}
+
+	return violations
+}
+
+// Get the raw values of a parameter from the request, and if it was present at all
+func paramValues(r *http.Request, param Parameters) ([]string, bool) {
+	switch param.In {
+	case "path":
+		val := chi.URLParam(r, param.Name)
+		return []string{val}, val != ""
+
+	case "query":
+		values, present := r.URL.Query()[param.Name]
+		return values, present
+
+	case "header":
+		values := r.Header.Values(param.Name)
+		return values, len(values) > 0
+
+	case "cookie":
+		cookie, err := r.Cookie(param.Name)
+		if err != nil {
+			return nil, false
+		}
+
+		return []string{cookie.Value}, true
+
+	case "formData":
+		if err := r.ParseMultipartForm(32 << 20); err != nil && err != http.ErrNotMultipart {
+			return nil, false
+		}
+
+		values, present := r.Form[param.Name]
+
+		return values, present
+	}
+
+	return nil, false
+}
+
+// Parameters are always strings, so convert them to the type in the schema then validate
+func validateParam(param Parameters, values []string, definitions map[string]Schema) []schemaError {
+	v := newValidator(definitions)
+
+	// The type to convert to can be behind a $ref, for the parameter or its items
+	s := v.resolve(param.schema())
+
+	if !s.Type.is("array") {
+		val, err := coerce(values[0], s.Type.primary())
+		if err != nil {
+			return []schemaError{{"", err.Error()}}
+		}
+
+		return v.validate(s, val)
+	}
+
+	// Arrays can be repeated parameters, or a single delimited value
+	if len(values) == 1 {
+		values = strings.Split(values[0], collectionDelimiter(param.CollectionFormat))
+	}
+
+	itemType := ""
+	if s.Items != nil {
+		itemType = v.resolve(*s.Items).Type.primary()
+	}
+
+	items := make([]any, 0, len(values))
+
+	for i, raw := range values {
+		val, err := coerce(raw, itemType)
+		if err != nil {
+			return []schemaError{{pointerTo("", i), err.Error()}}
+		}
+
+		items = append(items, val)
+	}
+
+	return v.validate(s, items)
+}
+
+func collectionDelimiter(format string) string {
+	switch format {
+	case "ssv":
+		return " "
+	case "tsv":
+		return "\t"
+	case "pipes":
+		return "|"
+	}
+
+	return ","
+}
+
+// Convert a string from a parameter to a value of the given type
+func coerce(raw, schemaType string) (any, error) {
+	switch schemaType {
+	case "integer":
+		val, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer, got '%s'", raw)
+		}
+
+		return val, nil
+
+	case "number":
+		val, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be a number, got '%s'", raw)
+		}
+
+		return val, nil
+
+	case "boolean":
+		val, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be a boolean, got '%s'", raw)
+		}
+
+		return val, nil
+	}
+
+	return raw, nil
+}
+
+// Check the body is present when required, and is valid JSON matching the schema
+// The body is put back on the request so it can be read again
+func validateBody(r *http.Request, param Parameters, definitions map[string]Schema) []violation {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return []violation{{"body", param.Name, "", "could not be read"}}
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(data))
+
+	if len(bytes.TrimSpace(data)) == 0 {
+		if param.Required {
+			return []violation{{"body", param.Name, "", "is required"}}
+		}
+
+		return nil
+	}
+
+	// Only JSON bodies can be checked, forms & other types are left alone
+	if mediaType := r.Header.Get("Content-Type"); mediaType != "" && !isJSON(mediaType) {
+		return nil
+	}
+
+	var body any
+	if err := json.Unmarshal(data, &body); err != nil {
+		return []violation{{"body", param.Name, "", "is not valid JSON: " + err.Error()}}
+	}
+
+	violations := []violation{}
+	for _, err := range newValidator(definitions).validate(param.Schema, body) {
+		violations = append(violations, violation{"body", param.Name, err.Pointer, err.Detail})
+	}
+
+	return violations
+}
+
+// Check a generated payload against the schema of the response, string payloads for
+// anything other than JSON are examples already encoded for the media type, so are skipped
+func checkResponse(resp Response, payload any, mediaType string, definitions map[string]Schema) []schemaError {
+	if _, isString := payload.(string); resp.Schema.isEmpty() || (isString && !isJSON(mediaType)) {
+		return nil
+	}
+
+	return newValidator(definitions).validate(resp.Schema, payload)
+}
+
+// Send problem details listing the violations
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string, violations []violation) {
+	prob := problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Errors:   violations,
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(prob)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestValidateRequest(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "*.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tempFile.Name())
+
+	_, err = tempFile.Write([]byte(`
+swagger: "2.0"
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /things/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        type: integer
+    post:
+      parameters:
+        - name: limit
+          in: query
+          required: true
+          type: integer
+          maximum: 100
+        - name: tags
+          in: query
+          type: array
+          items:
+            type: string
+            enum: [red, blue]
+        - name: x-trace
+          in: header
+          type: string
+          pattern: "^[a-f0-9]+$"
+        - name: body
+          in: body
+          required: true
+          schema:
+            $ref: "#/definitions/Thing"
+      responses:
+        "200":
+          description: OK
+definitions:
+  Thing:
+    type: object
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tempFile.Close()
+
+	spec, err := ParseSpec(tempFile.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op := spec.Paths["/things/{id}"].operations()[http.MethodPost]
+	if len(op.Parameters) != 5 {
+		t.Fatalf("expected path & operation parameters merged, got: %v", op.Parameters)
+	}
+
+	// Run the request through a router so path parameters are available
+	check := func(method, target, body string, headers map[string]string) []violation {
+		var violations []violation
+
+		router := chi.NewRouter()
+		router.Post("/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+			violations = validateRequest(r, op.Parameters, spec.Definitions)
+		})
+
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for name, val := range headers {
+			req.Header.Set(name, val)
+		}
+
+		router.ServeHTTP(httptest.NewRecorder(), req)
+
+		return violations
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		body     string
+		headers  map[string]string
+		expected []violation
+	}{
+		{"valid", "/things/1?limit=5&tags=red,blue", `{}`, map[string]string{"x-trace": "abc123"}, []violation{}},
+		{"path_type", "/things/abc?limit=5", `{}`, nil, []violation{
+			{"path", "id", "", "must be an integer, got 'abc'"},
+		}},
+		{"missing_query", "/things/1", `{}`, nil, []violation{
+			{"query", "limit", "", "is required"},
+		}},
+		{"maximum", "/things/1?limit=500", `{}`, nil, []violation{
+			{"query", "limit", "", "must be less than or equal to 100"},
+		}},
+		{"array_items", "/things/1?limit=5&tags=red&tags=green", `{}`, nil, []violation{
+			{"query", "tags", "/1", "must be one of [red blue]"},
+		}},
+		{"header_pattern", "/things/1?limit=5", `{}`, map[string]string{"x-trace": "xyz"}, []violation{
+			{"header", "x-trace", "", "must match pattern ^[a-f0-9]+$"},
+		}},
+		{"missing_body", "/things/1?limit=5", ``, nil, []violation{
+			{"body", "body", "", "is required"},
+		}},
+		{"body_type", "/things/1?limit=5", `[1, 2]`, nil, []violation{
+			{"body", "body", "", "must be of type object, got array"},
+		}},
+		{"everything", "/things/x", `{`, nil, []violation{
+			{"path", "id", "", "must be an integer, got 'x'"},
+			{"query", "limit", "", "is required"},
+			{"body", "body", "", "is not valid JSON: unexpected end of JSON input"},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations := check(http.MethodPost, test.target, test.body, test.headers)
+
+			if len(violations) != len(test.expected) {
+				t.Fatalf("expected %v, got: %v", test.expected, violations)
+			}
+
+			for i := range violations {
+				if violations[i] != test.expected[i] {
+					t.Errorf("expected %v, got: %v", test.expected[i], violations[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateRefParams(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"spec.yaml": `
+openapi: 3.0.3
+info:
+  title: Test API
+  version: 1.0.0
+paths:
+  /things/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            $ref: "#/components/schemas/Id"
+        - name: ids
+          in: query
+          schema:
+            type: array
+            items:
+              $ref: "#/components/schemas/Id"
+      responses:
+        "200":
+          description: OK
+components:
+  schemas:
+    Id:
+      type: integer
+      minimum: 1
+`,
+	})
+
+	spec, err := ParseSpec(filepath.Join(dir, "spec.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	params := spec.Paths["/things/{id}"].operations()[http.MethodGet].Parameters
+
+	tests := []struct {
+		param    Parameters
+		values   []string
+		expected []schemaError
+	}{
+		{params[0], []string{"5"}, []schemaError{}},
+		{params[0], []string{"0"}, []schemaError{{"", "must be greater than or equal to 1"}}},
+		{params[0], []string{"abc"}, []schemaError{{"", "must be an integer, got 'abc'"}}},
+		{params[1], []string{"1,2"}, []schemaError{}},
+		{params[1], []string{"1", "x"}, []schemaError{{"/1", "must be an integer, got 'x'"}}},
+	}
+
+	for _, test := range tests {
+		errs := validateParam(test.param, test.values, spec.Definitions)
+		if len(errs) != len(test.expected) || (len(errs) > 0 && errs[0] != test.expected[0]) {
+			t.Errorf("expected %v for %s %v, got: %v", test.expected, test.param.Name, test.values, errs)
+		}
+	}
+}
+
+func TestCheckResponses(t *testing.T) {
+	var op Operation
+	if err := json.Unmarshal([]byte(`{ "responses": { "200": {
+		"description": "OK",
+		"schema": { "type": "object", "required": ["id"], "properties": { "id": { "type": "integer" } } },
+		"examples": { "application/json": { "id": "abc" } }
+	} } }`), &op); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() { config.checkResponses = checkOff }()
+
+	tests := []struct {
+		mode    string
+		status  int
+		warning string
+	}{
+		{checkOff, http.StatusOK, ""},
+		{checkWarn, http.StatusOK, "/id must be of type integer, got string"},
+		{checkFail, http.StatusInternalServerError, "/id must be of type integer, got string"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.mode, func(t *testing.T) {
+			config.checkResponses = test.mode
+
+			rec := httptest.NewRecorder()
+			handler := createResponseHandler(mockRoute{api: &mockAPI{}, op: op})
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+			if rec.Code != test.status {
+				t.Errorf("expected status %d, got: %d", test.status, rec.Code)
+			}
+
+			if warning := rec.Header().Get("x-mock-warnings"); warning != test.warning {
+				t.Errorf("expected warning '%s', got: '%s'", test.warning, warning)
+			}
+		})
+	}
+
+	t.Run("encoded_example", func(t *testing.T) {
+		resp := Response{Schema: Schema{Type: SchemaType{"object"}}}
+		if errs := checkResponse(resp, "<pet/>", "application/xml", nil); len(errs) != 0 {
+			t.Errorf("expected XML string example to be skipped, got: %v", errs)
+		}
+	})
+}
@@ -0,0 +1,234 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Fallback values for scalar types, using formats & constraints
+// ----------------------------------------------------------------------------
+
+import (
+	"encoding/base64"
+	"log/slog"
+	"math"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Values for well known string formats, these are fixed so payloads are predictable
+var formatValues = map[string]string{
+	"date":      "2024-01-01",
+	"date-time": "2024-01-01T12:00:00Z",
+	"time":      "12:00:00",
+	"duration":  "P1D",
+	"uuid":      "3fa85f64-5717-4562-b3fc-2c963f66afa6",
+	"email":     "user@example.com",
+	"uri":       "https://example.com",
+	"url":       "https://example.com",
+	"hostname":  "example.com",
+	"ipv4":      "192.168.0.1",
+	"ipv6":      "2001:db8::1",
+	"byte":      base64.StdEncoding.EncodeToString([]byte("string")),
+	"binary":    "string",
+	"password":  "password",
+}
+
+// When there's no example, fall back to a value based on the type, format & constraints
+func (g *generator) scalar(s Schema) interface{} {
+	if g.fake {
+		return g.fakeScalar(s)
+	}
+
+	switch s.scalarType() {
+	case "string":
+		return stringValue(s)
+	case "integer":
+		return int64(numberValue(s, true))
+	case "number":
+		return numberValue(s, false)
+	case "boolean":
+		return false
+	}
+
+	return nil
+}
+
+// The type of a scalar, when it's left out the format or constraints give it away,
+// e.g. a lazy `format: uuid` is a string and `minimum: 1` is a number
+func (s Schema) scalarType() string {
+	switch {
+	case len(s.Type) > 0:
+		return s.Type.primary()
+	case s.Format != "" || s.Pattern != "" || s.MinLength != nil || s.MaxLength != nil:
+		return "string"
+	case s.hasConstraints() && s.MinItems == nil && s.MaxItems == nil:
+		return "number"
+	}
+
+	return ""
+}
+
+func stringValue(s Schema) string {
+	if val, ok := formatValues[s.Format]; ok {
+		return val
+	}
+
+	if s.Pattern != "" {
+		if val, ok := patternValue(s.Pattern); ok {
+			return val
+		}
+
+		logger.Debug("Unable to generate value for pattern", slog.Any("pattern", s.Pattern))
+	}
+
+	val := "string"
+
+	if s.MinLength != nil && len(val) < *s.MinLength {
+		val += strings.Repeat("x", *s.MinLength-len(val))
+	}
+
+	if s.MaxLength != nil && len(val) > *s.MaxLength && *s.MaxLength >= 0 {
+		val = val[:*s.MaxLength]
+	}
+
+	return val
+}
+
+// Pick a number that sits within the bounds & is a multiple of multipleOf, zero is
+// used if it's allowed, otherwise the lowest (or highest) value allowed
+func numberValue(s Schema, integer bool) float64 {
+	val := 0.0
+
+	// Smallest step we can move away from an exclusive bound
+	step := 1.0
+	if !integer {
+		step = 0.5
+	}
+
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		step = *s.MultipleOf
+	}
+
+	lower, lowerExclusive := s.lowerBound()
+	upper, upperExclusive := s.upperBound()
+
+	if lower != nil && (val < *lower || (lowerExclusive && val <= *lower)) {
+		val = *lower
+		if lowerExclusive {
+			val += step
+		}
+	} else if upper != nil && (val > *upper || (upperExclusive && val >= *upper)) {
+		val = *upper
+		if upperExclusive {
+			val -= step
+		}
+	}
+
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		val = math.Ceil(val / *s.MultipleOf) * *s.MultipleOf
+
+		// Rounding up might have pushed us past the upper bound
+		if upper != nil && (val > *upper || (upperExclusive && val >= *upper)) {
+			val -= *s.MultipleOf
+		}
+	}
+
+	if integer {
+		val = math.Ceil(val)
+	}
+
+	return val
+}
+
+// Generate a string that matches a regex, by walking the parsed regex and taking
+// the simplest path through it, the result is checked as it's not always possible
+func patternValue(pattern string) (string, bool) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+
+	var sb strings.Builder
+	writeRegex(&sb, re.Simplify())
+
+	val := sb.String()
+	if matched, _ := regexp.MatchString(pattern, val); !matched {
+		return "", false
+	}
+
+	return val, true
+}
+
+func writeRegex(sb *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		sb.WriteString(string(re.Rune))
+
+	case syntax.OpCharClass:
+		sb.WriteRune(classRune(re.Rune))
+
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		sb.WriteRune('a')
+
+	case syntax.OpCapture:
+		writeRegex(sb, re.Sub[0])
+
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			writeRegex(sb, sub)
+		}
+
+	case syntax.OpAlternate:
+		writeRegex(sb, re.Sub[0])
+
+	// One of each repeat is more useful than none, as they are often the main part
+	case syntax.OpStar, syntax.OpPlus:
+		writeRegex(sb, re.Sub[0])
+
+	case syntax.OpRepeat:
+		count := re.Min
+		if count == 0 && re.Max != 0 {
+			count = 1
+		}
+
+		for i := 0; i < count; i++ {
+			writeRegex(sb, re.Sub[0])
+		}
+	}
+
+	// Anything else e.g. anchors, empty matches & OpQuest add nothing
+}
+
+// Pick a rune from a char class, preferring letters & digits over symbols
+func classRune(ranges []rune) rune {
+	for _, preferred := range []rune{'a', 'A', '0'} {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if preferred >= ranges[i] && preferred <= ranges[i+1] {
+				return preferred
+			}
+		}
+	}
+
+	if len(ranges) > 0 {
+		return ranges[0]
+	}
+
+	return 'a'
+}
+
+// Numbers can come out of JSON & YAML decoding as a variety of types
+func toFloat(val any) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	}
+
+	return 0, false
+}
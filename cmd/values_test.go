@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+)
+
+func TestScalarValues(t *testing.T) {
+	gen := newGenerator(nil)
+
+	schemaFromJSON := func(t *testing.T, data string) Schema {
+		var s Schema
+		if err := json.Unmarshal([]byte(data), &s); err != nil {
+			t.Fatal(err)
+		}
+
+		return s
+	}
+
+	tests := []struct {
+		name     string
+		schema   string
+		expected any
+	}{
+		{"string", `{ "type": "string" }`, "string"},
+		{"date_time", `{ "type": "string", "format": "date-time" }`, "2024-01-01T12:00:00Z"},
+		{"uuid", `{ "type": "string", "format": "uuid" }`, "3fa85f64-5717-4562-b3fc-2c963f66afa6"},
+		{"format_no_type", `{ "format": "email" }`, "user@example.com"},
+		{"enum", `{ "type": "string", "enum": ["red", "green"] }`, "red"},
+		{"min_length", `{ "type": "string", "minLength": 10 }`, "stringxxxx"},
+		{"max_length", `{ "type": "string", "maxLength": 3 }`, "str"},
+		{"integer", `{ "type": "integer" }`, int64(0)},
+		{"integer_min", `{ "type": "integer", "minimum": 5 }`, int64(5)},
+		{"integer_exclusive_v2", `{ "type": "integer", "minimum": 5, "exclusiveMinimum": true }`, int64(6)},
+		{"integer_exclusive_v31", `{ "type": "integer", "exclusiveMinimum": 5 }`, int64(6)},
+		{"integer_max", `{ "type": "integer", "maximum": -10 }`, int64(-10)},
+		{"integer_multiple", `{ "type": "integer", "minimum": 7, "multipleOf": 5 }`, int64(10)},
+		{"number", `{ "type": "number", "minimum": 1.5 }`, 1.5},
+		{"number_exclusive", `{ "type": "number", "maximum": 0, "exclusiveMaximum": true }`, -0.5},
+		{"boolean", `{ "type": "boolean" }`, false},
+		{"min_length_no_type", `{ "minLength": 8 }`, "stringxx"},
+		{"minimum_no_type", `{ "minimum": 3 }`, 3.0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			val := gen.schema(schemaFromJSON(t, test.schema))
+			if val != test.expected {
+				t.Errorf("expected %v (%T), got: %v (%T)", test.expected, test.expected, val, val)
+			}
+		})
+	}
+
+	t.Run("pattern", func(t *testing.T) {
+		for _, pattern := range []string{`^\d{3}-\d{4}$`, `^[A-Z]{2}[0-9]+$`, `^(foo|bar)_[a-z]*$`, `^\w+@\w+\.com$`} {
+			val, ok := patternValue(pattern)
+			if !ok || !regexp.MustCompile(pattern).MatchString(val) {
+				t.Errorf("expected value matching %s, got: %v", pattern, val)
+			}
+		}
+	})
+
+	t.Run("min_items", func(t *testing.T) {
+		val := gen.schema(schemaFromJSON(t, `{ "type": "array", "minItems": 3, "items": { "type": "integer" } }`))
+		if items, ok := val.([]any); !ok || len(items) != 3 {
+			t.Errorf("expected array of 3 items, got: %v", val)
+		}
+	})
+
+	t.Run("max_items", func(t *testing.T) {
+		val := gen.schema(schemaFromJSON(t, `{ "type": "array", "maxItems": 0, "items": { "type": "integer" } }`))
+		if items, ok := val.([]any); !ok || len(items) != 0 {
+			t.Errorf("expected empty array, got: %v", val)
+		}
+	})
+	t.Run("constraints_no_type", func(t *testing.T) {
+		if val, isArray := gen.schema(schemaFromJSON(t, `{ "maxItems": 2 }`)).([]any); !isArray {
+			t.Errorf("expected an array, got: %v", val)
+		}
+
+		errs := newValidator(nil).validate(schemaFromJSON(t, `{ "maximum": 10 }`), 20.0)
+		if schemaFromJSON(t, `{ "maximum": 10 }`).isEmpty() || len(errs) != 1 {
+			t.Errorf("expected maximum to be checked, got: %v", errs)
+		}
+	})
+}
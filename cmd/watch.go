@@ -0,0 +1,176 @@
+package main
+
+// ----------------------------------------------------------------------------
+// Copyright (c) Ben Coleman, 2023. Licensed under the MIT License.
+// Mockery - Watching spec files for changes & reloading them without a restart
+// ----------------------------------------------------------------------------
+
+import (
+	"log/slog"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/lmittmann/tint"
+)
+
+// How often the spec files are checked for changes
+const watchInterval = time.Second
+
+// Serves requests with the current router, which can be swapped at any time
+type swappableHandler struct {
+	current atomic.Pointer[servedAPIs]
+}
+
+// A router & the APIs it was built from, these are always swapped together
+type servedAPIs struct {
+	router *chi.Mux
+	apis   []*mockAPI
+}
+
+func newSwappableHandler(router *chi.Mux, apis []*mockAPI) *swappableHandler {
+	h := &swappableHandler{}
+	h.swap(router, apis)
+
+	return h
+}
+
+func (h *swappableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.current.Load().router.ServeHTTP(w, r)
+}
+
+func (h *swappableHandler) swap(router *chi.Mux, apis []*mockAPI) {
+	h.current.Store(&servedAPIs{router, apis})
+}
+
+func (h *swappableHandler) apis() []*mockAPI {
+	return h.current.Load().apis
+}
+
+// When & how big a file was when last seen, a change to either means it has changed
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// Watches the spec files & the files they reference by polling, this needs no
+// extra dependencies and works with files on mounted volumes in containers
+type watcher struct {
+	values  []string
+	handler *swappableHandler
+
+	// Files referenced by the specs, from the last time they were loaded
+	refFiles []string
+
+	stamps map[string]fileStamp
+}
+
+// Start with the APIs already being served, the stamps are taken now so only
+// changes made from this point on cause a reload
+func newWatcher(values []string, handler *swappableHandler) *watcher {
+	w := &watcher{values: values, handler: handler}
+	w.refFiles = sourceFiles(handler.apis())
+	w.stamps = w.stampFiles()
+
+	return w
+}
+
+// Check for changes forever, this blocks so should be run in a goroutine
+func (w *watcher) run() {
+	logger.Info("Watching spec files for changes", slog.Any("files", len(w.stamps)))
+
+	for range time.Tick(watchInterval) {
+		w.poll()
+	}
+}
+
+// Reload the specs if any of the files have changed, been added or removed
+func (w *watcher) poll() {
+	stamps := w.stampFiles()
+	if equalStamps(stamps, w.stamps) {
+		return
+	}
+
+	w.stamps = stamps
+
+	logger.Info("Spec files changed, reloading")
+
+	apis, err := loadAPIs(w.values)
+	if err != nil {
+		logger.Error("Failed to reload specs, still serving the previous version", tint.Err(err))
+		return
+	}
+
+	router, err := newRouter(apis)
+	if err != nil {
+		logger.Error("Failed to reload routes, still serving the previous version", tint.Err(err))
+		return
+	}
+
+	w.handler.swap(router, apis)
+
+	// Refs may have been added or removed, so the files to watch can change
+	w.refFiles = sourceFiles(apis)
+	w.stamps = w.stampFiles()
+
+	logger.Warn("Reloaded specs", slog.Any("apis", len(apis)))
+}
+
+// Stamp every file that makes up the specs, the spec files are found again
+// each time, so files added to a watched directory are picked up
+func (w *watcher) stampFiles() map[string]fileStamp {
+	files := append([]string{}, w.refFiles...)
+
+	for _, value := range w.values {
+		specFiles, _, err := expandSpecFiles(value)
+		if err != nil {
+			// Missing files are part of the stamp, so deleting one is seen as a change
+			files = append(files, value)
+			continue
+		}
+
+		files = append(files, specFiles...)
+	}
+
+	stamps := map[string]fileStamp{}
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			stamps[file] = fileStamp{}
+			continue
+		}
+
+		stamps[file] = fileStamp{info.ModTime(), info.Size()}
+	}
+
+	return stamps
+}
+
+// All the files referenced by the specs, errors are ignored as the specs have already loaded
+func sourceFiles(apis []*mockAPI) []string {
+	files := []string{}
+
+	for _, api := range apis {
+		apiFiles, _ := specSourceFiles(api.file)
+		files = append(files, apiFiles...)
+	}
+
+	return files
+}
+
+func equalStamps(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for file, stamp := range a {
+		if other, exists := b[file]; !exists || !stamp.modTime.Equal(other.modTime) || stamp.size != other.size {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	dir := writeSpecFiles(t, map[string]string{
+		"spec.yaml": `
+swagger: "2.0"
+info:
+  title: Watched
+  version: 1.0.0
+paths:
+  /thing:
+    get:
+      responses:
+        "200":
+          description: OK
+          schema:
+            $ref: "./thing.yaml"
+`,
+		"thing.yaml": `
+type: string
+example: first
+`,
+	})
+
+	specFile := filepath.Join(dir, "spec.yaml")
+
+	apis, err := loadAPIs([]string{specFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router, err := newRouter(apis)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := newWatcher([]string{specFile}, newSwappableHandler(router, apis))
+
+	get := func(target string) string {
+		rec := httptest.NewRecorder()
+		w.handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+
+		return strings.TrimSpace(rec.Body.String())
+	}
+
+	// Modification times can be too coarse to see a quick change, so they are moved on
+	modTime := time.Now()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		modTime = modTime.Add(time.Second)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if body := get("/thing"); body != `"first"` {
+		t.Fatalf("expected first version, got: %s", body)
+	}
+
+	t.Run("referenced_file", func(t *testing.T) {
+		write("thing.yaml", "type: string\nexample: second\n")
+		w.poll()
+
+		if body := get("/thing"); body != `"second"` {
+			t.Errorf("expected reload after referenced file changed, got: %s", body)
+		}
+	})
+
+	t.Run("parse_error", func(t *testing.T) {
+		write("spec.yaml", "swagger: [\n")
+		w.poll()
+
+		if body := get("/thing"); body != `"second"` {
+			t.Errorf("expected previous version still served, got: %s", body)
+		}
+	})
+
+	t.Run("spec_file", func(t *testing.T) {
+		write("spec.yaml", `
+swagger: "2.0"
+info:
+  title: Watched
+  version: 1.0.1
+paths:
+  /other:
+    get:
+      responses:
+        "200":
+          description: OK
+          examples:
+            application/json: "other"
+`)
+		w.poll()
+
+		if body := get("/other"); body != `"other"` {
+			t.Errorf("expected new route after reload, got: %s", body)
+		}
+
+		if body := get("/thing"); body != "" {
+			t.Errorf("expected old route to be gone, got: %s", body)
+		}
+	})
+}